@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -22,7 +23,8 @@ func Init() error {
 	dbPath := filepath.Join(dbDir, "history.db")
 
 	var err error
-	DB, err = sql.Open("sqlite3", dbPath)
+	// 批量任务会并发写库，等待锁释放而不是立即返回 SQLITE_BUSY
+	DB, err = sql.Open("sqlite3", dbPath+"?_busy_timeout=5000")
 	if err != nil {
 		return err
 	}
@@ -36,11 +38,23 @@ func Init() error {
 		new_path TEXT NOT NULL,
 		new_name TEXT NOT NULL,
 		rule_name TEXT,
+		rule_id TEXT,
 		action TEXT NOT NULL,
 		status TEXT NOT NULL,
+		conflict TEXT,
+		content_hash TEXT,
+		size INTEGER,
+		mtime INTEGER,
+		original_removed INTEGER,
+		trash_path TEXT,
+		metadata TEXT,
+		steps TEXT,
+		mime_type TEXT,
+		undone_at DATETIME,
 		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 	CREATE INDEX IF NOT EXISTS idx_timestamp ON history(timestamp DESC);
+	CREATE INDEX IF NOT EXISTS idx_history_new_path ON history(new_path);
 	CREATE TABLE IF NOT EXISTS rules (
 		id TEXT PRIMARY KEY,
 		name TEXT NOT NULL,
@@ -49,6 +63,12 @@ func Init() error {
 		destination TEXT,
 		action TEXT,
 		keep_original INTEGER,
+		conflict_policy TEXT,
+		folder_mode TEXT,
+		preserve TEXT,
+		trash_originals INTEGER,
+		archive_format TEXT,
+		steps TEXT,
 		file_types TEXT,
 		custom_extensions TEXT,
 		allow_all_files INTEGER,
@@ -57,9 +77,101 @@ func Init() error {
 		ai_enabled INTEGER,
 		quick_access INTEGER,
 		enabled INTEGER,
+		conditions TEXT,
+		condition_tree TEXT,
+		priority INTEGER,
+		catch_all INTEGER,
 		created_at DATETIME,
 		updated_at DATETIME
 	);
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		status TEXT NOT NULL,
+		use_ai INTEGER,
+		model TEXT,
+		rule_id TEXT,
+		created_at DATETIME,
+		updated_at DATETIME
+	);
+	CREATE TABLE IF NOT EXISTS job_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id TEXT NOT NULL,
+		file_path TEXT NOT NULL,
+		status TEXT NOT NULL,
+		message TEXT,
+		destination TEXT,
+		history_id INTEGER,
+		updated_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_job_items_job ON job_items(job_id, status);
+	CREATE TABLE IF NOT EXISTS watch_folders (
+		id TEXT PRIMARY KEY,
+		path TEXT NOT NULL,
+		rule_id TEXT,
+		use_ai INTEGER,
+		model TEXT,
+		recursive INTEGER,
+		enabled INTEGER,
+		created_at DATETIME,
+		updated_at DATETIME
+	);
+	CREATE TABLE IF NOT EXISTS schedules (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		path TEXT NOT NULL,
+		cron TEXT NOT NULL,
+		rule_ids TEXT,
+		use_ai INTEGER,
+		model TEXT,
+		recursive INTEGER,
+		enabled INTEGER,
+		last_run_at DATETIME,
+		next_run_at DATETIME,
+		created_at DATETIME,
+		updated_at DATETIME
+	);
+	CREATE TABLE IF NOT EXISTS schedule_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		schedule_id TEXT NOT NULL,
+		trigger_type TEXT,
+		status TEXT NOT NULL,
+		total INTEGER,
+		succeeded INTEGER,
+		skipped INTEGER,
+		failed INTEGER,
+		unmatched INTEGER,
+		error TEXT,
+		history_id INTEGER,
+		started_at DATETIME,
+		finished_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule ON schedule_runs(schedule_id, id DESC);
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT,
+		rule_id TEXT,
+		events TEXT,
+		enabled INTEGER,
+		created_at DATETIME,
+		updated_at DATETIME
+	);
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id TEXT NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT,
+		status TEXT NOT NULL,
+		attempts INTEGER,
+		response_code INTEGER,
+		error TEXT,
+		next_attempt_at DATETIME,
+		created_at DATETIME,
+		updated_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id DESC);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
 	`
 
 	_, err = DB.Exec(createTable)
@@ -67,30 +179,139 @@ func Init() error {
 		return err
 	}
 
+	if err := migrate(); err != nil {
+		return err
+	}
+
 	log.Println("📊 Database initialized:", dbPath)
 	return nil
 }
 
-// SaveHistory 保存历史记录
-func SaveHistory(originalPath, originalName, newPath, newName, ruleName, action, status string) error {
-	stmt, err := DB.Prepare(`
-		INSERT INTO history (original_path, original_name, new_path, new_name, rule_name, action, status)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+// migrate 为旧版本数据库补齐新增的列
+func migrate() error {
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"history", "conflict", "TEXT"},
+		{"history", "content_hash", "TEXT"},
+		{"history", "size", "INTEGER"},
+		{"history", "mtime", "INTEGER"},
+		{"history", "original_removed", "INTEGER"},
+		{"history", "undone_at", "DATETIME"},
+		{"history", "metadata", "TEXT"},
+		{"rules", "conflict_policy", "TEXT"},
+		{"rules", "folder_mode", "TEXT"},
+		{"rules", "preserve", "TEXT"},
+		{"history", "trash_path", "TEXT"},
+		{"rules", "trash_originals", "INTEGER"},
+		{"rules", "archive_format", "TEXT"},
+		{"rules", "steps", "TEXT"},
+		{"history", "steps", "TEXT"},
+		{"history", "rule_id", "TEXT"},
+		{"rules", "priority", "INTEGER"},
+		{"rules", "catch_all", "INTEGER"},
+		{"rules", "conditions", "TEXT"},
+		{"rules", "condition_tree", "TEXT"},
+		{"history", "mime_type", "TEXT"},
+	}
+
+	for _, c := range columns {
+		if err := ensureColumn(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// 旧版本的规则按创建时间排序，保留原有顺序作为初始优先级
+	_, err := DB.Exec(`
+		UPDATE rules SET priority = (
+			SELECT COUNT(*) FROM rules r
+			WHERE r.created_at < rules.created_at OR (r.created_at = rules.created_at AND r.id < rules.id)
+		)
+		WHERE priority IS NULL
 	`)
+	return err
+}
+
+// ensureColumn 列不存在时通过 ALTER TABLE 添加
+func ensureColumn(table, column, definition string) error {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer rows.Close()
 
-	_, err = stmt.Exec(originalPath, originalName, newPath, newName, ruleName, action, status)
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	return err
 }
 
+// SaveHistory 保存历史记录，返回记录 ID
+func SaveHistory(record models.HistoryRecord) (int64, error) {
+	result, err := DB.Exec(`
+		INSERT INTO history (
+			original_path, original_name, new_path, new_name, rule_name, rule_id, action, status, conflict,
+			content_hash, size, mtime, original_removed, trash_path, metadata, steps, mime_type
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		record.OriginalPath,
+		record.OriginalName,
+		record.NewPath,
+		record.NewName,
+		record.RuleName,
+		record.RuleID,
+		record.Action,
+		record.Status,
+		record.Conflict,
+		record.ContentHash,
+		record.Size,
+		record.ModTime,
+		boolToInt(record.OriginalRemoved),
+		record.TrashPath,
+		marshalJSON(record.Metadata),
+		marshalJSON(record.Steps),
+		record.MIMEType,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+const historyColumns = `
+	id, original_path, original_name, new_path, new_name, rule_name, COALESCE(rule_id, ''), action, status,
+	COALESCE(conflict, ''), COALESCE(content_hash, ''), COALESCE(size, 0), COALESCE(mtime, 0),
+	COALESCE(original_removed, 0), COALESCE(trash_path, ''), COALESCE(metadata, ''), COALESCE(steps, ''),
+	COALESCE(mime_type, ''),
+	COALESCE(strftime('%Y-%m-%d %H:%M:%S', undone_at), ''),
+	strftime('%Y-%m-%d %H:%M:%S', timestamp) as timestamp
+`
+
 // GetHistory 获取历史记录
 func GetHistory() ([]models.HistoryRecord, error) {
 	query := `
-		SELECT id, original_path, original_name, new_path, new_name, rule_name, action, status, 
-		       strftime('%Y-%m-%d %H:%M:%S', timestamp) as timestamp
+		SELECT ` + historyColumns + `
 		FROM history
 		ORDER BY timestamp DESC
 		LIMIT 100
@@ -104,18 +325,7 @@ func GetHistory() ([]models.HistoryRecord, error) {
 
 	var records []models.HistoryRecord
 	for rows.Next() {
-		var record models.HistoryRecord
-		err := rows.Scan(
-			&record.ID,
-			&record.OriginalPath,
-			&record.OriginalName,
-			&record.NewPath,
-			&record.NewName,
-			&record.RuleName,
-			&record.Action,
-			&record.Status,
-			&record.Timestamp,
-		)
+		record, err := scanHistory(rows)
 		if err != nil {
 			continue
 		}
@@ -125,8 +335,88 @@ func GetHistory() ([]models.HistoryRecord, error) {
 	return records, nil
 }
 
+// GetHistoryRecord 获取单条历史记录
+func GetHistoryRecord(id int64) (models.HistoryRecord, error) {
+	row := DB.QueryRow(`SELECT `+historyColumns+` FROM history WHERE id = ?`, id)
+	return scanHistory(row)
+}
+
+// IsRuleOutput 判断路径是否为该规则成功处理（且未撤销）后得到的结果
+func IsRuleOutput(path, ruleID string) (bool, error) {
+	var exists int
+	err := DB.QueryRow(`
+		SELECT 1 FROM history
+		WHERE new_path = ? AND rule_id = ? AND status IN ('success', 'partial') AND undone_at IS NULL
+		LIMIT 1
+	`, path, ruleID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MarkHistoryUndone 将历史记录标记为已撤销
+func MarkHistoryUndone(id int64) error {
+	result, err := DB.Exec(`
+		UPDATE history SET status = 'undone', undone_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND undone_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // ClearHistory 清除历史记录
 func ClearHistory() error {
 	_, err := DB.Exec("DELETE FROM history")
 	return err
 }
+
+func scanHistory(scanner interface {
+	Scan(dest ...interface{}) error
+}) (models.HistoryRecord, error) {
+	var record models.HistoryRecord
+	var originalRemoved int
+	var metadata string
+	var steps string
+
+	err := scanner.Scan(
+		&record.ID,
+		&record.OriginalPath,
+		&record.OriginalName,
+		&record.NewPath,
+		&record.NewName,
+		&record.RuleName,
+		&record.RuleID,
+		&record.Action,
+		&record.Status,
+		&record.Conflict,
+		&record.ContentHash,
+		&record.Size,
+		&record.ModTime,
+		&originalRemoved,
+		&record.TrashPath,
+		&metadata,
+		&steps,
+		&record.MIMEType,
+		&record.UndoneAt,
+		&record.Timestamp,
+	)
+	if err != nil {
+		return models.HistoryRecord{}, err
+	}
+
+	record.OriginalRemoved = originalRemoved == 1
+	unmarshalJSON(metadata, &record.Metadata)
+	unmarshalJSON(steps, &record.Steps)
+	return record, nil
+}
@@ -0,0 +1,267 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"main/models"
+)
+
+func CreateJob(job models.Job, filePaths []string) (models.Job, error) {
+	if job.ID == "" {
+		job.ID = fmt.Sprintf("job_%d", time.Now().UnixNano())
+	}
+	now := time.Now().Format(time.RFC3339)
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return models.Job{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO jobs (id, status, use_ai, model, rule_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, job.Status, boolToInt(job.UseAI), job.Model, job.RuleID, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	for _, path := range filePaths {
+		_, err = tx.Exec(`
+			INSERT INTO job_items (job_id, file_path, status, updated_at)
+			VALUES (?, ?, 'pending', ?)
+		`, job.ID, path, now)
+		if err != nil {
+			return models.Job{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Job{}, err
+	}
+
+	return GetJob(job.ID)
+}
+
+const jobColumns = `
+	j.id, j.status, j.use_ai, COALESCE(j.model, ''), COALESCE(j.rule_id, ''), j.created_at, j.updated_at,
+	COUNT(i.id),
+	COALESCE(SUM(CASE WHEN i.status IN ('pending', 'processing') THEN 1 ELSE 0 END), 0),
+	COALESCE(SUM(CASE WHEN i.status = 'success' THEN 1 ELSE 0 END), 0),
+	COALESCE(SUM(CASE WHEN i.status = 'skipped' THEN 1 ELSE 0 END), 0),
+	COALESCE(SUM(CASE WHEN i.status IN ('failed', 'partial') THEN 1 ELSE 0 END), 0)
+`
+
+// GetJob 获取任务及其文件列表
+func GetJob(id string) (models.Job, error) {
+	row := DB.QueryRow(`
+		SELECT `+jobColumns+`
+		FROM jobs j LEFT JOIN job_items i ON i.job_id = j.id
+		WHERE j.id = ?
+		GROUP BY j.id
+	`, id)
+
+	job, err := scanJob(row)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	rows, err := DB.Query(`
+		SELECT id, job_id, file_path, status, COALESCE(message, ''), COALESCE(destination, ''),
+		       COALESCE(history_id, 0), updated_at
+		FROM job_items
+		WHERE job_id = ?
+		ORDER BY id ASC
+	`, id)
+	if err != nil {
+		return models.Job{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.JobItem
+		err := rows.Scan(
+			&item.ID,
+			&item.JobID,
+			&item.FilePath,
+			&item.Status,
+			&item.Message,
+			&item.Destination,
+			&item.HistoryID,
+			&item.UpdatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		job.Items = append(job.Items, item)
+	}
+
+	return job, nil
+}
+
+// GetJobs 获取最近的任务列表（不含文件明细）
+func GetJobs() ([]models.Job, error) {
+	rows, err := DB.Query(`
+		SELECT ` + jobColumns + `
+		FROM jobs j LEFT JOIN job_items i ON i.job_id = j.id
+		GROUP BY j.id
+		ORDER BY j.created_at DESC
+		LIMIT 50
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// UpdateJobStatus 在任务处于 from 中任一状态时将其切换为 to
+func UpdateJobStatus(id string, to string, from ...string) error {
+	query := `UPDATE jobs SET status = ?, updated_at = ? WHERE id = ?`
+	args := []interface{}{to, time.Now().Format(time.RFC3339), id}
+	if len(from) > 0 {
+		query += ` AND status IN (?` + repeatPlaceholder(len(from)-1) + `)`
+		for _, status := range from {
+			args = append(args, status)
+		}
+	}
+
+	result, err := DB.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CancelJobItems 将任务中尚未开始的文件标记为已取消
+func CancelJobItems(jobID string) error {
+	_, err := DB.Exec(`
+		UPDATE job_items SET status = 'cancelled', updated_at = ?
+		WHERE job_id = ? AND status = 'pending'
+	`, time.Now().Format(time.RFC3339), jobID)
+	return err
+}
+
+// ClaimNextJobItem 领取下一个待处理文件，没有可处理文件时返回 nil
+func ClaimNextJobItem() (*models.JobItem, error) {
+	for {
+		var item models.JobItem
+		err := DB.QueryRow(`
+			SELECT i.id, i.job_id, i.file_path
+			FROM job_items i JOIN jobs j ON j.id = i.job_id
+			WHERE i.status = 'pending' AND j.status = 'running'
+			ORDER BY j.created_at ASC, i.id ASC
+			LIMIT 1
+		`).Scan(&item.ID, &item.JobID, &item.FilePath)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// 多个 worker 可能同时选中同一条，以条件更新判定归属
+		result, err := DB.Exec(`
+			UPDATE job_items SET status = 'processing', updated_at = ?
+			WHERE id = ? AND status = 'pending'
+		`, time.Now().Format(time.RFC3339), item.ID)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if rows == 1 {
+			item.Status = "processing"
+			return &item, nil
+		}
+	}
+}
+
+// FinishJobItem 保存单个文件的处理结果
+func FinishJobItem(item models.JobItem) error {
+	_, err := DB.Exec(`
+		UPDATE job_items SET status = ?, message = ?, destination = ?, history_id = ?, updated_at = ?
+		WHERE id = ?
+	`, item.Status, item.Message, item.Destination, item.HistoryID, time.Now().Format(time.RFC3339), item.ID)
+	return err
+}
+
+// CompleteJobIfDone 所有文件处理完毕后将运行中的任务标记为完成
+func CompleteJobIfDone(jobID string) error {
+	_, err := DB.Exec(`
+		UPDATE jobs SET status = 'completed', updated_at = ?
+		WHERE id = ? AND status = 'running' AND NOT EXISTS (
+			SELECT 1 FROM job_items WHERE job_id = ? AND status IN ('pending', 'processing')
+		)
+	`, time.Now().Format(time.RFC3339), jobID, jobID)
+	return err
+}
+
+// ResetInterruptedJobItems 将上次退出时处理中的文件重新放回队列
+func ResetInterruptedJobItems() error {
+	_, err := DB.Exec(`
+		UPDATE job_items SET status = 'pending', updated_at = ?
+		WHERE status = 'processing'
+	`, time.Now().Format(time.RFC3339))
+	return err
+}
+
+func scanJob(scanner interface {
+	Scan(dest ...interface{}) error
+}) (models.Job, error) {
+	var job models.Job
+	var useAI int
+
+	err := scanner.Scan(
+		&job.ID,
+		&job.Status,
+		&useAI,
+		&job.Model,
+		&job.RuleID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.Total,
+		&job.Pending,
+		&job.Succeeded,
+		&job.Skipped,
+		&job.Failed,
+	)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	job.UseAI = useAI == 1
+	return job, nil
+}
+
+func repeatPlaceholder(n int) string {
+	placeholders := ""
+	for i := 0; i < n; i++ {
+		placeholders += ", ?"
+	}
+	return placeholders
+}
@@ -9,7 +9,17 @@ import (
 	"main/models"
 )
 
+// ruleExecer *sql.DB 或 *sql.Tx，规则导入时在同一事务中写入
+type ruleExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 func CreateRule(rule models.Rule) (models.Rule, error) {
+	return insertRule(DB, rule)
+}
+
+func insertRule(db ruleExecer, rule models.Rule) (models.Rule, error) {
 	if rule.ID == "" {
 		rule.ID = fmt.Sprintf("rule_%d", time.Now().UnixNano())
 	}
@@ -17,12 +27,18 @@ func CreateRule(rule models.Rule) (models.Rule, error) {
 	rule.CreatedAt = now
 	rule.UpdatedAt = now
 
-	_, err := DB.Exec(`
+	// 新规则排在已有规则之后
+	err := db.QueryRow(`SELECT COALESCE(MAX(priority) + 1, 0) FROM rules`).Scan(&rule.Priority)
+	if err != nil {
+		return models.Rule{}, err
+	}
+
+	_, err = db.Exec(`
 		INSERT INTO rules (
-			id, name, icon, color, destination, action, keep_original, file_types,
-			custom_extensions, allow_all_files, name_template, date_source,
-			ai_enabled, quick_access, enabled, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			id, name, icon, color, destination, action, keep_original, conflict_policy, folder_mode,
+			preserve, trash_originals, archive_format, steps, file_types, custom_extensions, allow_all_files, name_template,
+			date_source, ai_enabled, quick_access, enabled, conditions, condition_tree, priority, catch_all, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		rule.ID,
 		rule.Name,
@@ -31,6 +47,12 @@ func CreateRule(rule models.Rule) (models.Rule, error) {
 		rule.Destination,
 		rule.Action,
 		boolToInt(rule.KeepOriginal),
+		rule.ConflictPolicy,
+		rule.FolderMode,
+		marshalJSON(rule.Preserve),
+		boolToInt(rule.TrashOriginals),
+		rule.ArchiveFormat,
+		marshalSteps(rule.Steps),
 		marshalStringSlice(rule.FileTypes),
 		marshalStringSlice(rule.CustomExtensions),
 		boolToInt(rule.AllowAllFiles),
@@ -39,6 +61,10 @@ func CreateRule(rule models.Rule) (models.Rule, error) {
 		boolToInt(rule.AIEnabled),
 		boolToInt(rule.QuickAccess),
 		boolToInt(rule.Enabled),
+		marshalJSON(rule.Conditions),
+		marshalJSON(rule.ConditionTree),
+		rule.Priority,
+		boolToInt(rule.CatchAll),
 		rule.CreatedAt,
 		rule.UpdatedAt,
 	)
@@ -50,9 +76,16 @@ func CreateRule(rule models.Rule) (models.Rule, error) {
 }
 
 func UpdateRule(rule models.Rule) (models.Rule, error) {
+	if err := updateRule(DB, rule); err != nil {
+		return models.Rule{}, err
+	}
+	return GetRule(rule.ID)
+}
+
+func updateRule(db ruleExecer, rule models.Rule) error {
 	rule.UpdatedAt = time.Now().Format(time.RFC3339)
 
-	result, err := DB.Exec(`
+	result, err := db.Exec(`
 		UPDATE rules SET
 			name = ?,
 			icon = ?,
@@ -60,6 +93,12 @@ func UpdateRule(rule models.Rule) (models.Rule, error) {
 			destination = ?,
 			action = ?,
 			keep_original = ?,
+			conflict_policy = ?,
+			folder_mode = ?,
+			preserve = ?,
+			trash_originals = ?,
+			archive_format = ?,
+			steps = ?,
 			file_types = ?,
 			custom_extensions = ?,
 			allow_all_files = ?,
@@ -68,6 +107,9 @@ func UpdateRule(rule models.Rule) (models.Rule, error) {
 			ai_enabled = ?,
 			quick_access = ?,
 			enabled = ?,
+			conditions = ?,
+			condition_tree = ?,
+			catch_all = ?,
 			updated_at = ?
 		WHERE id = ?
 	`,
@@ -77,6 +119,12 @@ func UpdateRule(rule models.Rule) (models.Rule, error) {
 		rule.Destination,
 		rule.Action,
 		boolToInt(rule.KeepOriginal),
+		rule.ConflictPolicy,
+		rule.FolderMode,
+		marshalJSON(rule.Preserve),
+		boolToInt(rule.TrashOriginals),
+		rule.ArchiveFormat,
+		marshalSteps(rule.Steps),
 		marshalStringSlice(rule.FileTypes),
 		marshalStringSlice(rule.CustomExtensions),
 		boolToInt(rule.AllowAllFiles),
@@ -85,22 +133,148 @@ func UpdateRule(rule models.Rule) (models.Rule, error) {
 		boolToInt(rule.AIEnabled),
 		boolToInt(rule.QuickAccess),
 		boolToInt(rule.Enabled),
+		marshalJSON(rule.Conditions),
+		marshalJSON(rule.ConditionTree),
+		boolToInt(rule.CatchAll),
 		rule.UpdatedAt,
 		rule.ID,
 	)
 	if err != nil {
-		return models.Rule{}, err
+		return err
 	}
 
 	rows, err := result.RowsAffected()
 	if err != nil {
-		return models.Rule{}, err
+		return err
 	}
 	if rows == 0 {
-		return models.Rule{}, sql.ErrNoRows
+		return sql.ErrNoRows
 	}
+	return nil
+}
 
-	return rule, nil
+// ImportRules 在一个事务中删除、更新、新建规则。order 非空时按其顺序重新设置全部规则的优先级，
+// 否则新建的规则依次排在最后
+func ImportRules(creates, updates []models.Rule, deletes, order []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range deletes {
+		if _, err := tx.Exec(`DELETE FROM rules WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	if err := detachRules(tx, deletes); err != nil {
+		return err
+	}
+	for _, rule := range updates {
+		if err := updateRule(tx, rule); err != nil {
+			return err
+		}
+	}
+	for _, rule := range creates {
+		if _, err := insertRule(tx, rule); err != nil {
+			return err
+		}
+	}
+	for i, id := range order {
+		if _, err := tx.Exec(`UPDATE rules SET priority = ? WHERE id = ?`, i, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// detachRules 解除监听文件夹、定时整理与 webhook 对已删除规则的引用。
+// 清空规则后监听文件夹会改为自动匹配、webhook 会变为全局订阅，因此同时停用，由用户确认后再启用；
+// 定时整理从规则列表中移除这些规则，列表变为空时同样停用
+func detachRules(tx *sql.Tx, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	now := time.Now().Format(time.RFC3339)
+	deleted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+		if _, err := tx.Exec(`UPDATE watch_folders SET rule_id = '', enabled = 0, updated_at = ? WHERE rule_id = ?`, now, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE webhooks SET rule_id = '', enabled = 0, updated_at = ? WHERE rule_id = ?`, now, id); err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.Query(`SELECT id, COALESCE(rule_ids, '') FROM schedules`)
+	if err != nil {
+		return err
+	}
+	type scheduleRules struct {
+		id      string
+		ruleIDs []string
+	}
+	var changed []scheduleRules
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			rows.Close()
+			return err
+		}
+		ruleIDs := unmarshalStringSlice(data)
+		kept := make([]string, 0, len(ruleIDs))
+		for _, ruleID := range ruleIDs {
+			if !deleted[ruleID] {
+				kept = append(kept, ruleID)
+			}
+		}
+		if len(kept) != len(ruleIDs) {
+			changed = append(changed, scheduleRules{id: id, ruleIDs: kept})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, schedule := range changed {
+		_, err := tx.Exec(`
+			UPDATE schedules SET rule_ids = ?, enabled = CASE WHEN ? THEN 0 ELSE enabled END, updated_at = ?
+			WHERE id = ?
+		`, marshalStringSlice(schedule.ruleIDs), len(schedule.ruleIDs) == 0, now, schedule.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetRuleOrder 按给定顺序重新设置规则优先级，全部成功或全部不变
+func SetRuleOrder(ids []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Format(time.RFC3339)
+	for i, id := range ids {
+		result, err := tx.Exec(`UPDATE rules SET priority = ?, updated_at = ? WHERE id = ?`, i, now, id)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return sql.ErrNoRows
+		}
+	}
+
+	return tx.Commit()
 }
 
 func DeleteRule(id string) error {
@@ -120,11 +294,18 @@ func DeleteRule(id string) error {
 	return nil
 }
 
+const ruleColumns = `
+	id, name, icon, color, destination, action, keep_original,
+	COALESCE(conflict_policy, ''), COALESCE(folder_mode, ''), COALESCE(preserve, ''),
+	COALESCE(trash_originals, 0), COALESCE(archive_format, ''), COALESCE(steps, ''), file_types,
+	custom_extensions, allow_all_files, name_template, date_source,
+	ai_enabled, quick_access, enabled, COALESCE(conditions, ''), COALESCE(condition_tree, ''),
+	COALESCE(priority, 0), COALESCE(catch_all, 0), created_at, updated_at
+`
+
 func GetRule(id string) (models.Rule, error) {
 	row := DB.QueryRow(`
-		SELECT id, name, icon, color, destination, action, keep_original, file_types,
-		       custom_extensions, allow_all_files, name_template, date_source,
-		       ai_enabled, quick_access, enabled, created_at, updated_at
+		SELECT `+ruleColumns+`
 		FROM rules
 		WHERE id = ?
 	`, id)
@@ -134,11 +315,9 @@ func GetRule(id string) (models.Rule, error) {
 
 func GetRules() ([]models.Rule, error) {
 	rows, err := DB.Query(`
-		SELECT id, name, icon, color, destination, action, keep_original, file_types,
-		       custom_extensions, allow_all_files, name_template, date_source,
-		       ai_enabled, quick_access, enabled, created_at, updated_at
+		SELECT ` + ruleColumns + `
 		FROM rules
-		ORDER BY created_at ASC
+		ORDER BY COALESCE(catch_all, 0) ASC, COALESCE(priority, 0) ASC, created_at ASC
 	`)
 	if err != nil {
 		return nil, err
@@ -169,6 +348,12 @@ func scanRule(scanner interface {
 	var fileTypes string
 	var customExtensions string
 	var nameTemplate string
+	var preserve string
+	var trashOriginals int
+	var steps string
+	var catchAll int
+	var conditions string
+	var conditionTree string
 
 	err := scanner.Scan(
 		&rule.ID,
@@ -178,6 +363,12 @@ func scanRule(scanner interface {
 		&rule.Destination,
 		&rule.Action,
 		&keepOriginal,
+		&rule.ConflictPolicy,
+		&rule.FolderMode,
+		&preserve,
+		&trashOriginals,
+		&rule.ArchiveFormat,
+		&steps,
 		&fileTypes,
 		&customExtensions,
 		&allowAllFiles,
@@ -186,6 +377,10 @@ func scanRule(scanner interface {
 		&aiEnabled,
 		&quickAccess,
 		&enabled,
+		&conditions,
+		&conditionTree,
+		&rule.Priority,
+		&catchAll,
 		&rule.CreatedAt,
 		&rule.UpdatedAt,
 	)
@@ -198,9 +393,16 @@ func scanRule(scanner interface {
 	rule.AIEnabled = aiEnabled == 1
 	rule.QuickAccess = quickAccess == 1
 	rule.Enabled = enabled == 1
+	rule.TrashOriginals = trashOriginals == 1
+	rule.CatchAll = catchAll == 1
 	rule.FileTypes = unmarshalStringSlice(fileTypes)
 	rule.CustomExtensions = unmarshalStringSlice(customExtensions)
 	rule.NameTemplate = unmarshalStringSlice(nameTemplate)
+	unmarshalJSON(preserve, &rule.Preserve)
+	rule.Steps = []models.RuleStep{}
+	unmarshalJSON(steps, &rule.Steps)
+	unmarshalJSON(conditions, &rule.Conditions)
+	unmarshalJSON(conditionTree, &rule.ConditionTree)
 
 	return rule, nil
 }
@@ -233,3 +435,25 @@ func unmarshalStringSlice(data string) []string {
 	}
 	return items
 }
+
+func marshalSteps(steps []models.RuleStep) string {
+	if len(steps) == 0 {
+		return "[]"
+	}
+	return marshalJSON(steps)
+}
+
+func marshalJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func unmarshalJSON(data string, value interface{}) {
+	if data == "" {
+		return
+	}
+	json.Unmarshal([]byte(data), value)
+}
@@ -0,0 +1,275 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"main/models"
+)
+
+func CreateSchedule(schedule models.Schedule) (models.Schedule, error) {
+	if schedule.ID == "" {
+		schedule.ID = fmt.Sprintf("schedule_%d", time.Now().UnixNano())
+	}
+	now := time.Now().Format(time.RFC3339)
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+
+	_, err := DB.Exec(`
+		INSERT INTO schedules (
+			id, name, path, cron, rule_ids, use_ai, model, recursive, enabled,
+			next_run_at, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		schedule.ID,
+		schedule.Name,
+		schedule.Path,
+		schedule.Cron,
+		marshalStringSlice(schedule.RuleIDs),
+		boolToInt(schedule.UseAI),
+		schedule.Model,
+		boolToInt(schedule.Recursive),
+		boolToInt(schedule.Enabled),
+		schedule.NextRunAt,
+		schedule.CreatedAt,
+		schedule.UpdatedAt,
+	)
+	if err != nil {
+		return models.Schedule{}, err
+	}
+
+	return schedule, nil
+}
+
+func UpdateSchedule(schedule models.Schedule) (models.Schedule, error) {
+	schedule.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	result, err := DB.Exec(`
+		UPDATE schedules SET
+			name = ?,
+			path = ?,
+			cron = ?,
+			rule_ids = ?,
+			use_ai = ?,
+			model = ?,
+			recursive = ?,
+			enabled = ?,
+			next_run_at = ?,
+			updated_at = ?
+		WHERE id = ?
+	`,
+		schedule.Name,
+		schedule.Path,
+		schedule.Cron,
+		marshalStringSlice(schedule.RuleIDs),
+		boolToInt(schedule.UseAI),
+		schedule.Model,
+		boolToInt(schedule.Recursive),
+		boolToInt(schedule.Enabled),
+		schedule.NextRunAt,
+		schedule.UpdatedAt,
+		schedule.ID,
+	)
+	if err != nil {
+		return models.Schedule{}, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return models.Schedule{}, err
+	}
+	if rows == 0 {
+		return models.Schedule{}, sql.ErrNoRows
+	}
+
+	return GetSchedule(schedule.ID)
+}
+
+// DeleteSchedule 删除定时整理及其执行记录
+func DeleteSchedule(id string) error {
+	result, err := DB.Exec(`DELETE FROM schedules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = DB.Exec(`DELETE FROM schedule_runs WHERE schedule_id = ?`, id)
+	return err
+}
+
+// SetScheduleNextRun 更新下次执行时间
+func SetScheduleNextRun(id string, nextRunAt string) error {
+	_, err := DB.Exec(`UPDATE schedules SET next_run_at = ? WHERE id = ?`, nextRunAt, id)
+	return err
+}
+
+// SetScheduleLastRun 更新最近一次执行时间
+func SetScheduleLastRun(id string, lastRunAt string) error {
+	_, err := DB.Exec(`UPDATE schedules SET last_run_at = ? WHERE id = ?`, lastRunAt, id)
+	return err
+}
+
+const scheduleColumns = `
+	id, name, path, cron, COALESCE(rule_ids, ''), use_ai, COALESCE(model, ''), recursive, enabled,
+	COALESCE(last_run_at, ''), COALESCE(next_run_at, ''), created_at, updated_at
+`
+
+func GetSchedule(id string) (models.Schedule, error) {
+	row := DB.QueryRow(`SELECT `+scheduleColumns+` FROM schedules WHERE id = ?`, id)
+	return scanSchedule(row)
+}
+
+func GetSchedules() ([]models.Schedule, error) {
+	rows, err := DB.Query(`SELECT ` + scheduleColumns + ` FROM schedules ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []models.Schedule
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			continue
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+func scanSchedule(scanner interface {
+	Scan(dest ...interface{}) error
+}) (models.Schedule, error) {
+	var schedule models.Schedule
+	var ruleIDs string
+	var useAI int
+	var recursive int
+	var enabled int
+
+	err := scanner.Scan(
+		&schedule.ID,
+		&schedule.Name,
+		&schedule.Path,
+		&schedule.Cron,
+		&ruleIDs,
+		&useAI,
+		&schedule.Model,
+		&recursive,
+		&enabled,
+		&schedule.LastRunAt,
+		&schedule.NextRunAt,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+	)
+	if err != nil {
+		return models.Schedule{}, err
+	}
+
+	schedule.RuleIDs = unmarshalStringSlice(ruleIDs)
+	schedule.UseAI = useAI == 1
+	schedule.Recursive = recursive == 1
+	schedule.Enabled = enabled == 1
+	return schedule, nil
+}
+
+// CreateScheduleRun 记录一次开始执行的定时整理
+func CreateScheduleRun(run models.ScheduleRun) (models.ScheduleRun, error) {
+	run.StartedAt = time.Now().Format(time.RFC3339)
+
+	result, err := DB.Exec(`
+		INSERT INTO schedule_runs (schedule_id, trigger_type, status, started_at)
+		VALUES (?, ?, ?, ?)
+	`, run.ScheduleID, run.Trigger, run.Status, run.StartedAt)
+	if err != nil {
+		return models.ScheduleRun{}, err
+	}
+
+	run.ID, err = result.LastInsertId()
+	if err != nil {
+		return models.ScheduleRun{}, err
+	}
+	return run, nil
+}
+
+// FinishScheduleRun 保存执行结果
+func FinishScheduleRun(run models.ScheduleRun) error {
+	_, err := DB.Exec(`
+		UPDATE schedule_runs SET
+			status = ?, total = ?, succeeded = ?, skipped = ?, failed = ?, unmatched = ?,
+			error = ?, history_id = ?, finished_at = ?
+		WHERE id = ?
+	`,
+		run.Status,
+		run.Total,
+		run.Succeeded,
+		run.Skipped,
+		run.Failed,
+		run.Unmatched,
+		run.Error,
+		run.HistoryID,
+		run.FinishedAt,
+		run.ID,
+	)
+	return err
+}
+
+// ResetInterruptedScheduleRuns 将上次退出时仍在执行的记录标记为失败
+func ResetInterruptedScheduleRuns() error {
+	_, err := DB.Exec(`
+		UPDATE schedule_runs SET status = 'failed', error = '服务退出，执行中断', finished_at = ?
+		WHERE status = 'running'
+	`, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// GetScheduleRuns 获取最近 50 次执行记录
+func GetScheduleRuns(scheduleID string) ([]models.ScheduleRun, error) {
+	rows, err := DB.Query(`
+		SELECT id, schedule_id, COALESCE(trigger_type, ''), status, COALESCE(total, 0),
+			COALESCE(succeeded, 0), COALESCE(skipped, 0), COALESCE(failed, 0), COALESCE(unmatched, 0),
+			COALESCE(error, ''), COALESCE(history_id, 0), started_at, COALESCE(finished_at, '')
+		FROM schedule_runs
+		WHERE schedule_id = ?
+		ORDER BY id DESC
+		LIMIT 50
+	`, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []models.ScheduleRun
+	for rows.Next() {
+		var run models.ScheduleRun
+		err := rows.Scan(
+			&run.ID,
+			&run.ScheduleID,
+			&run.Trigger,
+			&run.Status,
+			&run.Total,
+			&run.Succeeded,
+			&run.Skipped,
+			&run.Failed,
+			&run.Unmatched,
+			&run.Error,
+			&run.HistoryID,
+			&run.StartedAt,
+			&run.FinishedAt,
+		)
+		if err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
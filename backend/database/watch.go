@@ -0,0 +1,150 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"main/models"
+)
+
+func CreateWatchFolder(folder models.WatchFolder) (models.WatchFolder, error) {
+	if folder.ID == "" {
+		folder.ID = fmt.Sprintf("watch_%d", time.Now().UnixNano())
+	}
+	now := time.Now().Format(time.RFC3339)
+	folder.CreatedAt = now
+	folder.UpdatedAt = now
+
+	_, err := DB.Exec(`
+		INSERT INTO watch_folders (id, path, rule_id, use_ai, model, recursive, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		folder.ID,
+		folder.Path,
+		folder.RuleID,
+		boolToInt(folder.UseAI),
+		folder.Model,
+		boolToInt(folder.Recursive),
+		boolToInt(folder.Enabled),
+		folder.CreatedAt,
+		folder.UpdatedAt,
+	)
+	if err != nil {
+		return models.WatchFolder{}, err
+	}
+
+	return folder, nil
+}
+
+func UpdateWatchFolder(folder models.WatchFolder) (models.WatchFolder, error) {
+	folder.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	result, err := DB.Exec(`
+		UPDATE watch_folders SET
+			path = ?,
+			rule_id = ?,
+			use_ai = ?,
+			model = ?,
+			recursive = ?,
+			enabled = ?,
+			updated_at = ?
+		WHERE id = ?
+	`,
+		folder.Path,
+		folder.RuleID,
+		boolToInt(folder.UseAI),
+		folder.Model,
+		boolToInt(folder.Recursive),
+		boolToInt(folder.Enabled),
+		folder.UpdatedAt,
+		folder.ID,
+	)
+	if err != nil {
+		return models.WatchFolder{}, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return models.WatchFolder{}, err
+	}
+	if rows == 0 {
+		return models.WatchFolder{}, sql.ErrNoRows
+	}
+
+	return GetWatchFolder(folder.ID)
+}
+
+func DeleteWatchFolder(id string) error {
+	result, err := DB.Exec(`DELETE FROM watch_folders WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+const watchFolderColumns = `
+	id, path, COALESCE(rule_id, ''), use_ai, COALESCE(model, ''), recursive, enabled, created_at, updated_at
+`
+
+func GetWatchFolder(id string) (models.WatchFolder, error) {
+	row := DB.QueryRow(`SELECT `+watchFolderColumns+` FROM watch_folders WHERE id = ?`, id)
+	return scanWatchFolder(row)
+}
+
+func GetWatchFolders() ([]models.WatchFolder, error) {
+	rows, err := DB.Query(`SELECT ` + watchFolderColumns + ` FROM watch_folders ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var folders []models.WatchFolder
+	for rows.Next() {
+		folder, err := scanWatchFolder(rows)
+		if err != nil {
+			continue
+		}
+		folders = append(folders, folder)
+	}
+
+	return folders, nil
+}
+
+func scanWatchFolder(scanner interface {
+	Scan(dest ...interface{}) error
+}) (models.WatchFolder, error) {
+	var folder models.WatchFolder
+	var useAI int
+	var recursive int
+	var enabled int
+
+	err := scanner.Scan(
+		&folder.ID,
+		&folder.Path,
+		&folder.RuleID,
+		&useAI,
+		&folder.Model,
+		&recursive,
+		&enabled,
+		&folder.CreatedAt,
+		&folder.UpdatedAt,
+	)
+	if err != nil {
+		return models.WatchFolder{}, err
+	}
+
+	folder.UseAI = useAI == 1
+	folder.Recursive = recursive == 1
+	folder.Enabled = enabled == 1
+	return folder, nil
+}
@@ -0,0 +1,268 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"main/models"
+)
+
+func CreateWebhook(webhook models.Webhook) (models.Webhook, error) {
+	if webhook.ID == "" {
+		webhook.ID = fmt.Sprintf("webhook_%d", time.Now().UnixNano())
+	}
+	now := time.Now().Format(time.RFC3339)
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+
+	_, err := DB.Exec(`
+		INSERT INTO webhooks (id, name, url, secret, rule_id, events, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		webhook.ID,
+		webhook.Name,
+		webhook.URL,
+		webhook.Secret,
+		webhook.RuleID,
+		marshalStringSlice(webhook.Events),
+		boolToInt(webhook.Enabled),
+		webhook.CreatedAt,
+		webhook.UpdatedAt,
+	)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+func UpdateWebhook(webhook models.Webhook) (models.Webhook, error) {
+	webhook.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	result, err := DB.Exec(`
+		UPDATE webhooks SET
+			name = ?,
+			url = ?,
+			secret = ?,
+			rule_id = ?,
+			events = ?,
+			enabled = ?,
+			updated_at = ?
+		WHERE id = ?
+	`,
+		webhook.Name,
+		webhook.URL,
+		webhook.Secret,
+		webhook.RuleID,
+		marshalStringSlice(webhook.Events),
+		boolToInt(webhook.Enabled),
+		webhook.UpdatedAt,
+		webhook.ID,
+	)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	if rows == 0 {
+		return models.Webhook{}, sql.ErrNoRows
+	}
+
+	return GetWebhook(webhook.ID)
+}
+
+// DeleteWebhook 删除 webhook 及其投递记录
+func DeleteWebhook(id string) error {
+	result, err := DB.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = DB.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id)
+	return err
+}
+
+const webhookColumns = `
+	id, name, url, COALESCE(secret, ''), COALESCE(rule_id, ''), COALESCE(events, ''), enabled,
+	created_at, updated_at
+`
+
+func GetWebhook(id string) (models.Webhook, error) {
+	row := DB.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id)
+	return scanWebhook(row)
+}
+
+func GetWebhooks() ([]models.Webhook, error) {
+	rows, err := DB.Query(`SELECT ` + webhookColumns + ` FROM webhooks ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, nil
+}
+
+func scanWebhook(scanner interface {
+	Scan(dest ...interface{}) error
+}) (models.Webhook, error) {
+	var webhook models.Webhook
+	var events string
+	var enabled int
+
+	err := scanner.Scan(
+		&webhook.ID,
+		&webhook.Name,
+		&webhook.URL,
+		&webhook.Secret,
+		&webhook.RuleID,
+		&events,
+		&enabled,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	webhook.Events = unmarshalStringSlice(events)
+	webhook.Enabled = enabled == 1
+	return webhook, nil
+}
+
+// CreateWebhookDelivery 记录一次待投递的事件
+func CreateWebhookDelivery(delivery models.WebhookDelivery) (models.WebhookDelivery, error) {
+	now := time.Now().Format(time.RFC3339)
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+
+	result, err := DB.Exec(`
+		INSERT INTO webhook_deliveries (
+			webhook_id, event, payload, status, attempts, response_code, error,
+			next_attempt_at, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		delivery.WebhookID,
+		delivery.Event,
+		delivery.Payload,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseCode,
+		delivery.Error,
+		delivery.NextAttemptAt,
+		delivery.CreatedAt,
+		delivery.UpdatedAt,
+	)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	delivery.ID, err = result.LastInsertId()
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	return delivery, nil
+}
+
+// UpdateWebhookDelivery 保存一次投递尝试的结果
+func UpdateWebhookDelivery(delivery models.WebhookDelivery) error {
+	_, err := DB.Exec(`
+		UPDATE webhook_deliveries SET
+			status = ?, attempts = ?, response_code = ?, error = ?, next_attempt_at = ?, updated_at = ?
+		WHERE id = ?
+	`,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseCode,
+		delivery.Error,
+		delivery.NextAttemptAt,
+		time.Now().Format(time.RFC3339),
+		delivery.ID,
+	)
+	return err
+}
+
+const webhookDeliveryColumns = `
+	id, webhook_id, event, COALESCE(payload, ''), status, COALESCE(attempts, 0),
+	COALESCE(response_code, 0), COALESCE(error, ''), COALESCE(next_attempt_at, ''), created_at, updated_at
+`
+
+// GetDueWebhookDeliveries 获取到达重试时间的待投递记录
+func GetDueWebhookDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := DB.Query(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= ?
+		ORDER BY next_attempt_at ASC
+		LIMIT ?
+	`, now.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanWebhookDeliveries(rows)
+}
+
+// GetWebhookDeliveries 获取 webhook 最近 50 次投递记录
+func GetWebhookDeliveries(webhookID string) ([]models.WebhookDelivery, error) {
+	rows, err := DB.Query(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT 50
+	`, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanWebhookDeliveries(rows)
+}
+
+func scanWebhookDeliveries(rows *sql.Rows) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.ResponseCode,
+			&delivery.Error,
+			&delivery.NextAttemptAt,
+			&delivery.CreatedAt,
+			&delivery.UpdatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 
@@ -61,7 +62,7 @@ func GetAIConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, models.Response{
 		Code:    0,
 		Message: "success",
-		Data:    services.GlobalAIConfig,
+		Data:    services.CurrentAIConfig(),
 	})
 }
 
@@ -76,15 +77,23 @@ func SaveAIConfig(c *gin.Context) {
 		return
 	}
 
+	if req.MaxConcurrency < 0 || req.MaxConcurrency > services.MaxAIConcurrency {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: fmt.Sprintf("max_concurrency 必须在 0 到 %d 之间", services.MaxAIConcurrency),
+		})
+		return
+	}
+
 	// 更新全局配置
-	services.GlobalAIConfig = req
+	services.ReconfigureAI(req)
 
 	log.Printf("AI 配置已更新: Provider=%s, Model=%s", req.Provider, req.Model)
 
 	c.JSON(http.StatusOK, models.Response{
 		Code:    0,
 		Message: "配置保存成功",
-		Data:    services.GlobalAIConfig,
+		Data:    services.CurrentAIConfig(),
 	})
 }
 
@@ -99,7 +108,7 @@ func AnalyzeFile(c *gin.Context) {
 		return
 	}
 
-	analysis, err := services.AnalyzeFile(req.FilePath, services.GlobalAIConfig.Model)
+	analysis, err := services.AnalyzeFile(c.Request.Context(), req.FilePath, "")
 	if err != nil {
 		c.JSON(http.StatusOK, models.Response{
 			Code:    2001,
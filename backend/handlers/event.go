@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"io"
+	"time"
+
+	"main/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventHeartbeatInterval SSE 心跳间隔，避免空闲连接被中间层断开
+const eventHeartbeatInterval = 15 * time.Second
+
+// StreamEvents 以 Server-Sent Events 推送处理事件
+// 可通过 request_id / job_id 查询参数只订阅相关事件
+func StreamEvents(c *gin.Context) {
+	requestID := c.Query("request_id")
+	jobID := c.Query("job_id")
+
+	ch, unsubscribe := services.SubscribeEvents()
+	defer unsubscribe()
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Format(time.RFC3339))
+			return true
+		case event, ok := <-ch:
+			if !ok {
+				return false
+			}
+			if requestID != "" && event.RequestID != requestID {
+				return true
+			}
+			if jobID != "" && event.JobID != jobID {
+				return true
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		}
+	})
+}
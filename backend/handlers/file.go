@@ -1,13 +1,12 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
+	"strconv"
+	"time"
 
 	"main/database"
 	"main/models"
@@ -27,158 +26,83 @@ func ProcessFile(c *gin.Context) {
 		return
 	}
 
-	// 检查文件是否存在
-	if _, err := os.Stat(req.FilePath); os.IsNotExist(err) {
+	if req.RequestID == "" {
+		req.RequestID = fmt.Sprintf("req_%d", time.Now().UnixNano())
+	}
+	ctx := services.WithEventScope(c.Request.Context(), req.RequestID, "", req.FilePath)
+
+	response, err := services.ProcessFile(ctx, req)
+	if err != nil {
 		c.JSON(http.StatusOK, models.Response{
-			Code:    1001,
-			Message: "File not found",
+			Code:    planErrorCode(err),
+			Message: err.Error(),
 		})
 		return
 	}
-
-	// 获取文件名和扩展名
-	originalName := filepath.Base(req.FilePath)
-	ext := filepath.Ext(originalName)
-	nameWithoutExt := strings.TrimSuffix(originalName, ext)
-
-	// 查找规则
-	var rule *models.Rule
-	if req.RuleID != "" {
-		foundRule, err := database.GetRule(req.RuleID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				c.JSON(http.StatusOK, models.Response{
-					Code:    3000,
-					Message: "规则不存在",
-				})
-				return
-			}
-			c.JSON(http.StatusOK, models.Response{
-				Code:    5000,
-				Message: "获取规则失败: " + err.Error(),
-			})
-			return
-		}
-		rule = &foundRule
-	} else {
-		rules, err := database.GetRules()
-		if err == nil {
-			rule = services.MatchRuleForFile(req.FilePath, rules)
+	response.RequestID = req.RequestID
+
+	message := "处理成功"
+	switch response.Status {
+	case "skipped":
+		message = "目标已存在，已跳过"
+		if response.Conflict == services.ResolutionUnchanged {
+			message = "文件已在目标位置，已跳过"
 		}
+	case "partial":
+		message = "处理完成，部分步骤失败"
 	}
 
-	ruleName := "默认规则"
-	action := "copy"
-	keepOriginal := false
-	dateSource := "current"
-	nameTemplate := []string{}
-	useAI := req.UseAI
-
-	// 目标目录
-	homeDir, _ := os.UserHomeDir()
-	destDir := filepath.Join(homeDir, "Documents", "BlackHole")
-
-	if rule != nil {
-		if rule.Name != "" {
-			ruleName = rule.Name
-		}
-		if rule.Action != "" {
-			action = rule.Action
-		}
-		if rule.Destination != "" {
-			destDir = rule.Destination
-		}
-		keepOriginal = rule.KeepOriginal
-		if rule.DateSource != "" {
-			dateSource = rule.DateSource
-		}
-		if len(rule.NameTemplate) > 0 {
-			nameTemplate = rule.NameTemplate
-		}
-		if rule.AIEnabled {
-			useAI = true
-		}
-	}
-
-	// 确保目标目录存在
-	os.MkdirAll(destDir, 0755)
-
-	// AI 分析结果
-	var aiAnalysis *models.AIAnalysis
-	aiName := ""
-	if useAI {
-		analysis, err := services.AnalyzeFile(req.FilePath, req.Model)
-		if err != nil {
-			log.Printf("AI 分析失败: %v", err)
-			aiAnalysis = &models.AIAnalysis{
-				SuggestedName: nameWithoutExt,
-				Category:      "文档",
-				Confidence:    0.5,
-			}
-			aiName = aiAnalysis.SuggestedName
-		} else {
-			aiAnalysis = analysis
-			if aiAnalysis.SuggestedName != "" {
-				aiName = aiAnalysis.SuggestedName
-			}
-		}
-	}
-
-	// 生成新文件名
-	fileDate := services.SelectTimestamp(req.FilePath, dateSource)
-	var newBase string
-	if len(nameTemplate) > 0 {
-		newBase = services.BuildNameFromTemplate(nameTemplate, originalName, aiName, fileDate)
-	} else {
-		base := nameWithoutExt
-		if aiName != "" {
-			base = aiName
-		}
-		newBase = fmt.Sprintf("%s_%s", fileDate.Format("2006-01-02"), base)
-	}
-	newName := newBase + ext
-	destPath := filepath.Join(destDir, newName)
-
-	operation := "copy"
-	var processErr error
-	if action == "move" && !keepOriginal {
-		operation = "move"
-		processErr = services.MoveFile(req.FilePath, destPath)
-	} else {
-		processErr = services.CopyFile(req.FilePath, destPath)
-	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: message,
+		Data:    response,
+	})
+}
 
-	if processErr != nil {
-		log.Printf("文件处理失败: %v", processErr)
-		database.SaveHistory(req.FilePath, originalName, destPath, newName, ruleName, operation, "failed")
+// PlanFile 预演文件处理，返回处理计划但不修改文件
+func PlanFile(c *gin.Context) {
+	var req models.FileProcessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusOK, models.Response{
-			Code:    5000,
-			Message: "文件处理失败: " + processErr.Error(),
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
 		})
 		return
 	}
 
-	response := models.FileProcessResponse{
-		OriginalPath: req.FilePath,
-		OriginalName: originalName,
-		NewName:      newName,
-		Destination:  destPath,
-		RuleUsed:     ruleName,
-		AIAnalysis:   aiAnalysis,
+	ctx := services.WithEventScope(c.Request.Context(), req.RequestID, "", req.FilePath)
+	plan, err := services.PlanFile(ctx, req)
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    planErrorCode(err),
+			Message: err.Error(),
+		})
+		return
 	}
 
-	// 保存到历史记录
-	database.SaveHistory(req.FilePath, originalName, destPath, newName, ruleName, operation, "success")
-
-	log.Printf("处理文件: %s -> %s", req.FilePath, destPath)
-
 	c.JSON(http.StatusOK, models.Response{
 		Code:    0,
-		Message: "处理成功",
-		Data:    response,
+		Message: "success",
+		Data:    plan,
 	})
 }
 
+func planErrorCode(err error) int {
+	switch {
+	case errors.Is(err, services.ErrFileNotFound):
+		return 1001
+	case errors.Is(err, services.ErrRuleNotFound):
+		return 3000
+	case errors.Is(err, services.ErrActionUnsupported),
+		errors.Is(err, services.ErrArchiveUnsafe),
+		errors.Is(err, services.ErrArchiveTooLarge),
+		errors.Is(err, services.ErrCancelled):
+		return 4000
+	default:
+		return 5000
+	}
+}
+
 // GetHistory 获取历史记录
 func GetHistory(c *gin.Context) {
 	records, err := database.GetHistory()
@@ -212,3 +136,71 @@ func ClearHistory(c *gin.Context) {
 		Message: "历史记录已清除",
 	})
 }
+
+// UndoHistory 撤销单条历史记录
+func UndoHistory(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "历史记录ID无效",
+		})
+		return
+	}
+
+	if err := services.UndoHistory(id); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    undoErrorCode(err),
+			Message: err.Error(),
+		})
+		return
+	}
+
+	log.Printf("撤销历史记录: %d", id)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "撤销成功",
+	})
+}
+
+// UndoHistoryBatch 批量撤销历史记录
+func UndoHistoryBatch(c *gin.Context) {
+	var req models.UndoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	results := make([]models.UndoResult, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		result := models.UndoResult{ID: id, Success: true, Message: "撤销成功"}
+		if err := services.UndoHistory(id); err != nil {
+			result.Success = false
+			result.Message = err.Error()
+		} else {
+			log.Printf("撤销历史记录: %d", id)
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "success",
+		Data:    results,
+	})
+}
+
+func undoErrorCode(err error) int {
+	switch {
+	case errors.Is(err, services.ErrHistoryNotFound):
+		return 3000
+	case errors.Is(err, services.ErrUndoRejected):
+		return 4000
+	default:
+		return 5000
+	}
+}
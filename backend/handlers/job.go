@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"main/database"
+	"main/models"
+	"main/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateJob 创建批量处理任务
+func CreateJob(c *gin.Context) {
+	var req models.JobCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	if len(req.FilePaths) == 0 {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "文件列表不能为空",
+		})
+		return
+	}
+
+	job, err := services.CreateJob(req)
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "创建任务失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "任务已创建",
+		Data:    job,
+	})
+}
+
+// GetJobs 获取任务列表
+func GetJobs(c *gin.Context) {
+	jobs, err := database.GetJobs()
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "获取任务失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "success",
+		Data:    jobs,
+	})
+}
+
+// GetJob 获取任务详情及每个文件的状态
+func GetJob(c *gin.Context) {
+	job, err := database.GetJob(c.Param("id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, models.Response{
+				Code:    3000,
+				Message: "任务不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "获取任务失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "success",
+		Data:    job,
+	})
+}
+
+// PauseJob 暂停任务
+func PauseJob(c *gin.Context) {
+	respondJobControl(c, services.PauseJob(c.Param("id")), "任务已暂停")
+}
+
+// ResumeJob 恢复任务
+func ResumeJob(c *gin.Context) {
+	respondJobControl(c, services.ResumeJob(c.Param("id")), "任务已恢复")
+}
+
+// CancelJob 取消任务
+func CancelJob(c *gin.Context) {
+	respondJobControl(c, services.CancelJob(c.Param("id")), "任务已取消")
+}
+
+func respondJobControl(c *gin.Context, err error, message string) {
+	if err != nil {
+		code := 5000
+		switch {
+		case errors.Is(err, services.ErrJobNotFound):
+			code = 3000
+		case errors.Is(err, services.ErrJobState):
+			code = 4000
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    code,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	job, _ := database.GetJob(c.Param("id"))
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: message,
+		Data:    job,
+	})
+}
@@ -2,14 +2,22 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"main/database"
 	"main/models"
+	"main/services"
 
 	"github.com/gin-gonic/gin"
 )
 
+// maxRuleBundleSize 导入规则包的大小上限
+const maxRuleBundleSize = 5 << 20
+
 // GetRules 获取规则列表
 func GetRules(c *gin.Context) {
 	rules, err := database.GetRules()
@@ -39,6 +47,14 @@ func CreateRule(c *gin.Context) {
 		return
 	}
 
+	if err := services.ValidateRule(rule); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	created, err := database.CreateRule(rule)
 	if err != nil {
 		c.JSON(http.StatusOK, models.Response{
@@ -66,8 +82,34 @@ func UpdateRule(c *gin.Context) {
 		return
 	}
 
-	var rule models.Rule
-	if err := c.ShouldBindJSON(&rule); err != nil {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	existing, err := database.GetRule(ruleID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, models.Response{
+				Code:    3000,
+				Message: "规则不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "获取规则失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 只更新请求中出现的字段，旧版客户端不发送的字段保持原值
+	rule, err := services.MergeRuleUpdate(existing, body)
+	if err != nil {
 		c.JSON(http.StatusOK, models.Response{
 			Code:    1000,
 			Message: "Invalid request body: " + err.Error(),
@@ -76,6 +118,14 @@ func UpdateRule(c *gin.Context) {
 	}
 	rule.ID = ruleID
 
+	if err := services.ValidateRule(rule); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	updated, err := database.UpdateRule(rule)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -130,3 +180,177 @@ func DeleteRule(c *gin.Context) {
 		Message: "删除成功",
 	})
 }
+
+// ReorderRules 调整规则匹配顺序
+func ReorderRules(c *gin.Context) {
+	var req models.RuleOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if err := services.ReorderRules(req.RuleIDs); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRuleOrder):
+			c.JSON(http.StatusOK, models.Response{
+				Code:    1000,
+				Message: err.Error(),
+			})
+		default:
+			c.JSON(http.StatusOK, models.Response{
+				Code:    5000,
+				Message: "调整规则顺序失败: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	rules, err := database.GetRules()
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "获取规则失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "顺序已更新",
+		Data:    rules,
+	})
+}
+
+// TestRules 测试文件会匹配哪条规则，返回每条规则的判断过程与预期结果
+func TestRules(c *gin.Context) {
+	var req models.RuleTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	result, err := services.ExplainRules(req)
+	if err != nil {
+		code := 5000
+		switch {
+		case errors.Is(err, services.ErrInvalidRuleTest):
+			code = 1000
+		case errors.Is(err, services.ErrFileNotFound):
+			code = 1001
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    code,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "success",
+		Data:    result,
+	})
+}
+
+// ExportRules 导出规则包：?format=json|yaml，?ids=a,b 只导出指定规则
+func ExportRules(c *gin.Context) {
+	format := c.DefaultQuery("format", services.BundleJSON)
+	if format != services.BundleJSON && format != services.BundleYAML {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "format 必须是 json 或 yaml",
+		})
+		return
+	}
+
+	var ids []string
+	if value := c.Query("ids"); value != "" {
+		ids = strings.Split(value, ",")
+	}
+
+	bundle, err := services.ExportRules(ids)
+	if err != nil {
+		code := 5000
+		if errors.Is(err, services.ErrRuleNotFound) {
+			code = 3000
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    code,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	data, err := services.EncodeRuleBundle(bundle, format)
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "导出规则失败: " + err.Error(),
+		})
+		return
+	}
+
+	contentType := "application/json; charset=utf-8"
+	if format == services.BundleYAML {
+		contentType = "application/yaml; charset=utf-8"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="blackhole-rules.%s"`, format))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportRules 导入规则包，请求体为导出的 JSON 或 YAML。
+// ?mode=merge|replace，?on_conflict=skip|overwrite|copy，?dry_run=true 只预览冲突不写入，
+// ?force=true 允许 replace 模式删除仍被引用的规则
+func ImportRules(c *gin.Context) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxRuleBundleSize+1))
+	if err != nil || len(data) > maxRuleBundleSize {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "规则包读取失败或超过 5 MB",
+		})
+		return
+	}
+
+	bundle, err := services.DecodeRuleBundle(data, c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true" || c.Query("dry_run") == "1"
+	force := c.Query("force") == "true" || c.Query("force") == "1"
+	result, err := services.ImportRules(bundle, c.Query("mode"), c.Query("on_conflict"), dryRun, force)
+	if err != nil {
+		code := 5000
+		switch {
+		case errors.Is(err, services.ErrInvalidBundle):
+			code = 1000
+		case errors.Is(err, services.ErrRuleInUse):
+			code = 4000
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    code,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := "导入成功"
+	if dryRun {
+		message = "预览"
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: message,
+		Data:    result,
+	})
+}
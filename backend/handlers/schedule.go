@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"main/database"
+	"main/models"
+	"main/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSchedules 获取定时整理列表
+func GetSchedules(c *gin.Context) {
+	schedules, err := database.GetSchedules()
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "获取定时整理失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "success",
+		Data:    schedules,
+	})
+}
+
+// CreateSchedule 创建定时整理
+func CreateSchedule(c *gin.Context) {
+	var schedule models.Schedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if err := services.NormalizeSchedule(&schedule); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	created, err := database.CreateSchedule(schedule)
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "创建定时整理失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "创建成功",
+		Data:    created,
+	})
+}
+
+// UpdateSchedule 更新定时整理
+func UpdateSchedule(c *gin.Context) {
+	scheduleID := c.Param("id")
+	if scheduleID == "" {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "定时整理ID不能为空",
+		})
+		return
+	}
+
+	var schedule models.Schedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	schedule.ID = scheduleID
+
+	if err := services.NormalizeSchedule(&schedule); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	updated, err := database.UpdateSchedule(schedule)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, models.Response{
+				Code:    3000,
+				Message: "定时整理不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "更新定时整理失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "更新成功",
+		Data:    updated,
+	})
+}
+
+// DeleteSchedule 删除定时整理
+func DeleteSchedule(c *gin.Context) {
+	scheduleID := c.Param("id")
+	if scheduleID == "" {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "定时整理ID不能为空",
+		})
+		return
+	}
+
+	if err := database.DeleteSchedule(scheduleID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, models.Response{
+				Code:    3000,
+				Message: "定时整理不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "删除定时整理失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "删除成功",
+	})
+}
+
+// RunSchedule 立即执行一次定时整理
+func RunSchedule(c *gin.Context) {
+	run, err := services.RunScheduleNow(c.Param("id"))
+	if err != nil {
+		code := 5000
+		switch {
+		case errors.Is(err, services.ErrScheduleNotFound):
+			code = 3000
+		case errors.Is(err, services.ErrScheduleRunning):
+			code = 4000
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    code,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "已开始执行",
+		Data:    run,
+	})
+}
+
+// GetScheduleRuns 获取定时整理的执行记录
+func GetScheduleRuns(c *gin.Context) {
+	runs, err := database.GetScheduleRuns(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "获取执行记录失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "success",
+		Data:    runs,
+	})
+}
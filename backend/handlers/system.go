@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"main/models"
+	"main/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -30,6 +31,7 @@ func Status(c *gin.Context) {
 			"status":  "running",
 			"version": "1.0.0",
 			"uptime":  time.Now().Unix(),
+			"ai":      services.GetAIQueueStats(),
 		},
 	})
 }
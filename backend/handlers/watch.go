@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"main/database"
+	"main/models"
+	"main/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetWatchFolders 获取监听文件夹列表
+func GetWatchFolders(c *gin.Context) {
+	folders, err := services.ListWatchFolders()
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "获取监听文件夹失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "success",
+		Data:    folders,
+	})
+}
+
+// CreateWatchFolder 添加监听文件夹
+func CreateWatchFolder(c *gin.Context) {
+	var folder models.WatchFolder
+	if err := c.ShouldBindJSON(&folder); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if err := services.NormalizeWatchFolder(&folder); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	created, err := database.CreateWatchFolder(folder)
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "添加监听文件夹失败: " + err.Error(),
+		})
+		return
+	}
+
+	reloadWatcher(created.ID)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "添加成功",
+		Data:    created,
+	})
+}
+
+// UpdateWatchFolder 更新监听文件夹
+func UpdateWatchFolder(c *gin.Context) {
+	folderID := c.Param("id")
+	if folderID == "" {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "监听文件夹ID不能为空",
+		})
+		return
+	}
+
+	var folder models.WatchFolder
+	if err := c.ShouldBindJSON(&folder); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	folder.ID = folderID
+
+	if err := services.NormalizeWatchFolder(&folder); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	updated, err := database.UpdateWatchFolder(folder)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, models.Response{
+				Code:    3000,
+				Message: "监听文件夹不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "更新监听文件夹失败: " + err.Error(),
+		})
+		return
+	}
+
+	reloadWatcher(updated.ID)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "更新成功",
+		Data:    updated,
+	})
+}
+
+// DeleteWatchFolder 删除监听文件夹
+func DeleteWatchFolder(c *gin.Context) {
+	folderID := c.Param("id")
+	if folderID == "" {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "监听文件夹ID不能为空",
+		})
+		return
+	}
+
+	if err := database.DeleteWatchFolder(folderID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, models.Response{
+				Code:    3000,
+				Message: "监听文件夹不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "删除监听文件夹失败: " + err.Error(),
+		})
+		return
+	}
+
+	reloadWatcher(folderID)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "删除成功",
+	})
+}
+
+// reloadWatcher 配置已保存，监听重启失败只记录日志
+func reloadWatcher(id string) {
+	if err := services.ReloadWatcher(id); err != nil {
+		log.Printf("重启监听文件夹失败 %s: %v", id, err)
+	}
+}
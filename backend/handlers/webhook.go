@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"main/database"
+	"main/models"
+	"main/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetWebhooks 获取 webhook 列表
+func GetWebhooks(c *gin.Context) {
+	webhooks, err := database.GetWebhooks()
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "获取 webhook 失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "success",
+		Data:    maskWebhooks(webhooks),
+	})
+}
+
+// CreateWebhook 创建 webhook
+func CreateWebhook(c *gin.Context) {
+	var webhook models.Webhook
+	if err := c.ShouldBindJSON(&webhook); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if err := services.NormalizeWebhook(&webhook); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    webhookErrorCode(err),
+			Message: err.Error(),
+		})
+		return
+	}
+
+	created, err := database.CreateWebhook(webhook)
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "创建 webhook 失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "创建成功",
+		Data:    created,
+	})
+}
+
+// UpdateWebhook 更新 webhook
+func UpdateWebhook(c *gin.Context) {
+	webhookID := c.Param("id")
+	if webhookID == "" {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "webhook ID不能为空",
+		})
+		return
+	}
+
+	var webhook models.Webhook
+	if err := c.ShouldBindJSON(&webhook); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	webhook.ID = webhookID
+
+	// 未提供密钥时保留原密钥
+	if webhook.Secret == "" {
+		if existing, err := database.GetWebhook(webhookID); err == nil {
+			webhook.Secret = existing.Secret
+		}
+	}
+
+	if err := services.NormalizeWebhook(&webhook); err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    webhookErrorCode(err),
+			Message: err.Error(),
+		})
+		return
+	}
+
+	updated, err := database.UpdateWebhook(webhook)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, models.Response{
+				Code:    3000,
+				Message: "webhook 不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "更新 webhook 失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "更新成功",
+		Data:    maskWebhook(updated),
+	})
+}
+
+// DeleteWebhook 删除 webhook
+func DeleteWebhook(c *gin.Context) {
+	webhookID := c.Param("id")
+	if webhookID == "" {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    1000,
+			Message: "webhook ID不能为空",
+		})
+		return
+	}
+
+	if err := database.DeleteWebhook(webhookID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, models.Response{
+				Code:    3000,
+				Message: "webhook 不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "删除 webhook 失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "删除成功",
+	})
+}
+
+// TestWebhook 立即发送一次测试事件
+func TestWebhook(c *gin.Context) {
+	delivery, err := services.TestWebhook(c.Param("id"))
+	if err != nil {
+		code := 5000
+		if errors.Is(err, services.ErrWebhookNotFound) {
+			code = 3000
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    code,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := "发送成功"
+	if delivery.Status != services.DeliverySuccess {
+		message = "发送失败: " + delivery.Error
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: message,
+		Data:    delivery,
+	})
+}
+
+// GetWebhookDeliveries 获取 webhook 的投递记录
+func GetWebhookDeliveries(c *gin.Context) {
+	deliveries, err := database.GetWebhookDeliveries(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    5000,
+			Message: "获取投递记录失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    0,
+		Message: "success",
+		Data:    deliveries,
+	})
+}
+
+// maskWebhook 去掉签名密钥后返回，密钥只在创建时返回一次
+func maskWebhook(webhook models.Webhook) models.Webhook {
+	webhook.Secret = ""
+	return webhook
+}
+
+func maskWebhooks(webhooks []models.Webhook) []models.Webhook {
+	masked := make([]models.Webhook, len(webhooks))
+	for i, webhook := range webhooks {
+		masked[i] = maskWebhook(webhook)
+	}
+	return masked
+}
+
+func webhookErrorCode(err error) int {
+	if errors.Is(err, services.ErrRuleNotFound) {
+		return 3000
+	}
+	return 1000
+}
@@ -6,6 +6,7 @@ import (
 
 	"main/database"
 	"main/routes"
+	"main/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,6 +17,24 @@ func main() {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
+	// 启动批量任务 worker
+	if err := services.StartJobWorkers(services.DefaultJobWorkers); err != nil {
+		log.Fatal("Failed to start job workers:", err)
+	}
+
+	// 启动监听文件夹
+	if err := services.StartWatchers(); err != nil {
+		log.Fatal("Failed to start watch folders:", err)
+	}
+
+	// 启动定时整理
+	if err := services.StartScheduler(); err != nil {
+		log.Fatal("Failed to start scheduler:", err)
+	}
+
+	// 启动 webhook 投递
+	services.StartWebhookDispatcher()
+
 	// 设置 Gin 模式
 	// gin.SetMode(gin.ReleaseMode) // 生产环境使用
 
@@ -34,9 +53,24 @@ func main() {
 	fmt.Println("📡 API endpoints:")
 	fmt.Println("   - GET  /api/health            - 健康检查")
 	fmt.Println("   - GET  /api/status            - 获取状态")
+	fmt.Println("   - GET  /api/events            - 处理事件流 (SSE)")
 	fmt.Println("   - POST /api/files/process     - 处理文件")
+	fmt.Println("   - POST /api/files/plan        - 预演文件处理")
+	fmt.Println("   - POST /api/jobs              - 创建批量处理任务")
+	fmt.Println("   - GET  /api/jobs/:id          - 获取任务进度")
+	fmt.Println("   - GET/POST /api/watch-folders - 监听文件夹")
+	fmt.Println("   - GET/POST /api/schedules     - 定时整理")
+	fmt.Println("   - POST /api/schedules/:id/run - 立即执行定时整理")
+	fmt.Println("   - GET/POST /api/webhooks      - Webhook 订阅")
+	fmt.Println("   - POST /api/webhooks/:id/test - 测试 Webhook")
 	fmt.Println("   - GET  /api/history           - 获取历史记录")
 	fmt.Println("   - POST /api/history/clear     - 清除历史记录")
+	fmt.Println("   - POST /api/history/:id/undo  - 撤销历史记录")
+	fmt.Println("   - POST /api/history/undo      - 批量撤销历史记录")
+	fmt.Println("   - PUT  /api/rules/order       - 调整规则顺序")
+	fmt.Println("   - POST /api/rules/test        - 测试规则匹配")
+	fmt.Println("   - GET  /api/rules/export      - 导出规则包")
+	fmt.Println("   - POST /api/rules/import      - 导入规则包")
 	fmt.Println("   - GET  /api/ollama/models     - 获取Ollama模型列表")
 	fmt.Println("   - GET  /api/templates         - 获取模板列表")
 	fmt.Println("   - POST /api/templates/import  - 导入模板")
@@ -13,6 +13,8 @@ type FileProcessRequest struct {
 	UseAI    bool   `json:"use_ai"`
 	Model    string `json:"model"`
 	RuleID   string `json:"rule_id,omitempty"`
+	// RequestID 用于关联 /api/events 中的事件，为空时由后端生成
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // FileProcessResponse 文件处理响应
@@ -22,7 +24,54 @@ type FileProcessResponse struct {
 	NewName      string      `json:"new_name"`
 	Destination  string      `json:"destination"`
 	RuleUsed     string      `json:"rule_used"`
+	Status       string      `json:"status"`   // success, partial（流水线部分步骤失败）, skipped or failed
+	Conflict     string      `json:"conflict"` // 目标冲突处理结果
+	HistoryID    int64       `json:"history_id,omitempty"`
+	RequestID    string      `json:"request_id,omitempty"`
+	Error        string      `json:"error,omitempty"`
 	AIAnalysis   *AIAnalysis `json:"ai_analysis,omitempty"`
+	// Steps 规则流水线中每个步骤的执行结果
+	Steps []StepResult `json:"steps,omitempty"`
+	// Children 展开处理文件夹时每个文件的结果
+	Children []FileProcessResponse `json:"children,omitempty"`
+}
+
+// FilePlan 文件处理计划（预演结果，不修改文件系统）
+type FilePlan struct {
+	OriginalPath    string          `json:"original_path"`
+	OriginalName    string          `json:"original_name"`
+	NewName         string          `json:"new_name"`
+	Destination     string          `json:"destination"`
+	RuleUsed        string          `json:"rule_used"`
+	RuleID          string          `json:"rule_id,omitempty"`
+	Action          string          `json:"action"`                   // copy, move, symlink, hardlink, clone, in_place, extract or compress
+	ConflictPolicy  string          `json:"conflict_policy"`          // 目标冲突处理策略
+	Conflict        string          `json:"conflict"`                 // 目标冲突处理结果
+	WillWrite       bool            `json:"will_write"`               // 是否会写入目标
+	RemovesOriginal bool            `json:"removes_original"`         // 是否会删除原文件
+	TrashOriginals  bool            `json:"trash_originals"`          // 删除原文件时放入回收站
+	ArchiveFormat   string          `json:"archive_format,omitempty"` // 打包格式（compress 动作）
+	FileType        string          `json:"file_type,omitempty"`      // 文件分类，如 image、document
+	MIMEType        string          `json:"mime_type,omitempty"`      // 按文件头识别的 MIME 类型
+	Preserve        PreserveOptions `json:"preserve"`
+	AIAnalysis      *AIAnalysis     `json:"ai_analysis,omitempty"`
+	// Steps 规则流水线的执行计划（Action 为 pipeline 时）
+	Steps []PlanStep `json:"steps,omitempty"`
+	// Expand 为 true 时文件夹被展开，Children 为其中每个文件的计划
+	Expand   bool       `json:"expand,omitempty"`
+	Children []FilePlan `json:"children,omitempty"`
+}
+
+// Event 处理过程事件（通过 /api/events 推送）
+type Event struct {
+	Type      string  `json:"type"` // stage, progress, completed, failed or job
+	RequestID string  `json:"request_id,omitempty"`
+	JobID     string  `json:"job_id,omitempty"`
+	FilePath  string  `json:"file_path,omitempty"`
+	Stage     string  `json:"stage,omitempty"`
+	Message   string  `json:"message,omitempty"`
+	Progress  float64 `json:"progress,omitempty"` // 百分比 0-100
+	Time      string  `json:"time"`
 }
 
 // AIAnalysis AI 分析结果
@@ -32,17 +81,77 @@ type AIAnalysis struct {
 	Confidence    float64 `json:"confidence"`
 }
 
+// JobCreateRequest 创建批量处理任务请求
+type JobCreateRequest struct {
+	FilePaths []string `json:"file_paths" binding:"required"`
+	UseAI     bool     `json:"use_ai"`
+	Model     string   `json:"model"`
+	RuleID    string   `json:"rule_id,omitempty"`
+}
+
+// Job 批量处理任务
+type Job struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"` // running, paused, completed or cancelled
+	UseAI     bool      `json:"use_ai"`
+	Model     string    `json:"model"`
+	RuleID    string    `json:"rule_id,omitempty"`
+	Total     int       `json:"total"`
+	Pending   int       `json:"pending"`
+	Succeeded int       `json:"succeeded"`
+	Skipped   int       `json:"skipped"`
+	Failed    int       `json:"failed"`
+	CreatedAt string    `json:"created_at"`
+	UpdatedAt string    `json:"updated_at"`
+	Items     []JobItem `json:"items,omitempty"`
+}
+
+// JobItem 任务中的单个文件
+type JobItem struct {
+	ID          int64  `json:"id"`
+	JobID       string `json:"job_id"`
+	FilePath    string `json:"file_path"`
+	Status      string `json:"status"` // pending, processing, success, partial, skipped, failed or cancelled
+	Message     string `json:"message,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	HistoryID   int64  `json:"history_id,omitempty"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
 // HistoryRecord 历史记录
 type HistoryRecord struct {
-	ID           int64  `json:"id"`
-	OriginalPath string `json:"original_path"`
-	OriginalName string `json:"original_name"`
-	NewPath      string `json:"new_path"`
-	NewName      string `json:"new_name"`
-	RuleName     string `json:"rule_name"`
-	Action       string `json:"action"` // copy or move
-	Status       string `json:"status"` // success or failed
-	Timestamp    string `json:"timestamp"`
+	ID              int64             `json:"id"`
+	OriginalPath    string            `json:"original_path"`
+	OriginalName    string            `json:"original_name"`
+	NewPath         string            `json:"new_path"`
+	NewName         string            `json:"new_name"`
+	RuleName        string            `json:"rule_name"`
+	RuleID          string            `json:"rule_id,omitempty"`
+	Action          string            `json:"action"`   // copy, move, symlink, hardlink, clone, in_place, extract, compress, pipeline or sweep
+	Status          string            `json:"status"`   // success, partial, skipped, failed or undone
+	Conflict        string            `json:"conflict"` // 目标冲突处理结果
+	ContentHash     string            `json:"content_hash"`
+	MIMEType        string            `json:"mime_type,omitempty"` // 按文件头识别的原文件 MIME 类型
+	Size            int64             `json:"size"`
+	ModTime         int64             `json:"mtime"` // 写入后目标文件的修改时间（UnixNano）
+	OriginalRemoved bool              `json:"original_removed"`
+	TrashPath       string            `json:"trash_path,omitempty"` // 原文件在回收站中的位置
+	Metadata        map[string]string `json:"metadata,omitempty"`   // times、xattrs、owner 的保留情况；解压与打包记录格式和条目数；定时整理记录为统计信息
+	Steps           []StepResult      `json:"steps,omitempty"`      // 规则流水线中每个步骤的执行结果
+	UndoneAt        string            `json:"undone_at,omitempty"`
+	Timestamp       string            `json:"timestamp"`
+}
+
+// UndoRequest 批量撤销请求
+type UndoRequest struct {
+	IDs []int64 `json:"ids" binding:"required"`
+}
+
+// UndoResult 单条撤销结果
+type UndoResult struct {
+	ID      int64  `json:"id"`
+	Success bool   `json:"success"`
+	Message string `json:"message"`
 }
 
 // Template 模板结构
@@ -62,10 +171,25 @@ type TemplateComponent struct {
 
 // AIConfig AI 配置
 type AIConfig struct {
+	Provider       string `json:"provider"`
+	APIKey         string `json:"api_key"`
+	BaseURL        string `json:"base_url"`
+	Model          string `json:"model"`
+	MaxConcurrency int    `json:"max_concurrency"` // 同时进行的分析数，0 表示默认值
+}
+
+// AIProviderQueue 单个 AI 提供商的并发与排队情况
+type AIProviderQueue struct {
 	Provider string `json:"provider"`
-	APIKey   string `json:"api_key"`
-	BaseURL  string `json:"base_url"`
-	Model    string `json:"model"`
+	Limit    int    `json:"limit"`
+	Active   int    `json:"active"`
+	Queued   int    `json:"queued"`
+}
+
+// AIQueueStats AI 分析队列状态
+type AIQueueStats struct {
+	Providers []AIProviderQueue `json:"providers"`
+	InFlight  int               `json:"in_flight"` // 进行中（含排队）的去重后调用数
 }
 
 // AITestRequest AI 测试连接请求
@@ -82,23 +206,281 @@ type AIAnalyzeRequest struct {
 	AnalyzeType string `json:"analyze_type"`
 }
 
+// WatchFolder 监听文件夹（收件箱），新文件出现后自动处理
+type WatchFolder struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	RuleID    string `json:"rule_id,omitempty"` // 为空时自动匹配规则
+	UseAI     bool   `json:"use_ai"`
+	Model     string `json:"model,omitempty"`
+	Recursive bool   `json:"recursive"`
+	Enabled   bool   `json:"enabled"`
+	Mode      string `json:"mode,omitempty"` // 运行状态：inotify / polling，未运行时为空
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// Schedule 定时整理任务：按 cron 表达式定期整理某个目录
+type Schedule struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Path      string   `json:"path"`
+	Cron      string   `json:"cron"`               // 分 时 日 月 周，如 "0 2 * * *"
+	RuleIDs   []string `json:"rule_ids,omitempty"` // 参与匹配的规则，为空时使用全部规则
+	UseAI     bool     `json:"use_ai"`
+	Model     string   `json:"model,omitempty"`
+	Recursive bool     `json:"recursive"`
+	Enabled   bool     `json:"enabled"`
+	LastRunAt string   `json:"last_run_at,omitempty"`
+	NextRunAt string   `json:"next_run_at,omitempty"`
+	CreatedAt string   `json:"created_at,omitempty"`
+	UpdatedAt string   `json:"updated_at,omitempty"`
+}
+
+// ScheduleRun 定时整理的一次执行结果
+type ScheduleRun struct {
+	ID         int64  `json:"id"`
+	ScheduleID string `json:"schedule_id"`
+	Trigger    string `json:"trigger"` // schedule 或 manual
+	Status     string `json:"status"`  // running, success or failed
+	Total      int    `json:"total"`
+	Succeeded  int    `json:"succeeded"`
+	Skipped    int    `json:"skipped"`
+	Failed     int    `json:"failed"`
+	Unmatched  int    `json:"unmatched"` // 没有匹配到规则而保持原样的文件
+	Error      string `json:"error,omitempty"`
+	HistoryID  int64  `json:"history_id,omitempty"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at,omitempty"`
+}
+
+// Webhook 处理事件的订阅：事件发生时向 URL POST 签名后的 JSON
+type Webhook struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"`  // HMAC-SHA256 签名密钥，为空时自动生成；只在创建时返回
+	RuleID    string   `json:"rule_id,omitempty"` // 只订阅该规则的事件，为空时订阅全部
+	Events    []string `json:"events,omitempty"`  // success, failed or undone，为空时订阅全部
+	Enabled   bool     `json:"enabled"`
+	CreatedAt string   `json:"created_at,omitempty"`
+	UpdatedAt string   `json:"updated_at,omitempty"`
+}
+
+// WebhookDelivery webhook 的一次投递（包含重试）
+type WebhookDelivery struct {
+	ID            int64  `json:"id"`
+	WebhookID     string `json:"webhook_id"`
+	Event         string `json:"event"`
+	Payload       string `json:"payload"`
+	Status        string `json:"status"` // pending, success or failed
+	Attempts      int    `json:"attempts"`
+	ResponseCode  int    `json:"response_code,omitempty"`
+	Error         string `json:"error,omitempty"`
+	NextAttemptAt string `json:"next_attempt_at,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+// WebhookPayload webhook 发送的内容
+type WebhookPayload struct {
+	Event     string               `json:"event"`
+	Timestamp string               `json:"timestamp"`
+	RuleID    string               `json:"rule_id,omitempty"`
+	HistoryID int64                `json:"history_id,omitempty"`
+	Error     string               `json:"error,omitempty"`
+	Response  *FileProcessResponse `json:"response,omitempty"`
+}
+
+// PreserveOptions 复制或移动时需要保留的元数据
+type PreserveOptions struct {
+	Times  bool `json:"times"`  // 访问时间与修改时间
+	Xattrs bool `json:"xattrs"` // 扩展属性（如 user.xdg.origin.url）
+	Owner  bool `json:"owner"`  // 属主与属组（通常需要足够权限）
+}
+
 // Rule 文件处理规则
 type Rule struct {
-	ID               string   `json:"id"`
-	Name             string   `json:"name"`
-	Icon             string   `json:"icon"`
-	Color            string   `json:"color"`
-	Destination      string   `json:"destination"`
-	Action           string   `json:"action"`
-	KeepOriginal     bool     `json:"keep_original"`
-	FileTypes        []string `json:"file_types"`
-	CustomExtensions []string `json:"custom_extensions"`
-	AllowAllFiles    bool     `json:"allow_all_files"`
-	NameTemplate     []string `json:"name_template"`
-	DateSource       string   `json:"date_source"`
-	AIEnabled        bool     `json:"ai_enabled"`
-	QuickAccess      bool     `json:"quick_access"`
-	Enabled          bool     `json:"enabled"`
-	CreatedAt        string   `json:"created_at,omitempty"`
-	UpdatedAt        string   `json:"updated_at,omitempty"`
+	ID               string          `json:"id"`
+	Name             string          `json:"name"`
+	Icon             string          `json:"icon"`
+	Color            string          `json:"color"`
+	Destination      string          `json:"destination"`
+	Action           string          `json:"action"` // copy, move, symlink, hardlink, clone, in_place, extract or compress
+	KeepOriginal     bool            `json:"keep_original"`
+	ConflictPolicy   string          `json:"conflict_policy"` // rename, skip, overwrite, keep_newest, dedupe
+	FolderMode       string          `json:"folder_mode"`     // unit or expand
+	Preserve         PreserveOptions `json:"preserve"`
+	TrashOriginals   bool            `json:"trash_originals"` // 需要删除原文件时放入回收站
+	ArchiveFormat    string          `json:"archive_format"`  // compress 动作的打包格式：zip or tar.gz
+	Steps            []RuleStep      `json:"steps"`           // 处理流水线，非空时按顺序执行并替代 Action
+	FileTypes        []string        `json:"file_types"`
+	CustomExtensions []string        `json:"custom_extensions"`
+	AllowAllFiles    bool            `json:"allow_all_files"`
+	Conditions       RuleConditions  `json:"conditions"`               // 附加匹配条件，与文件类型、扩展名同时满足
+	ConditionTree    *ConditionNode  `json:"condition_tree,omitempty"` // 条件树，与上面的条件同时满足
+	NameTemplate     []string        `json:"name_template"`
+	DateSource       string          `json:"date_source"`
+	AIEnabled        bool            `json:"ai_enabled"`
+	QuickAccess      bool            `json:"quick_access"`
+	Enabled          bool            `json:"enabled"`
+	Priority         int             `json:"priority"`  // 匹配顺序，越小越先匹配，通过 PUT /api/rules/order 调整
+	CatchAll         bool            `json:"catch_all"` // 兜底规则：匹配所有文件，始终排在其他规则之后
+	CreatedAt        string          `json:"created_at,omitempty"`
+	UpdatedAt        string          `json:"updated_at,omitempty"`
+}
+
+// RuleConditions 规则的附加匹配条件，未设置的条件不参与判断
+type RuleConditions struct {
+	NameGlob     string   `json:"name_glob,omitempty"`     // 文件名 glob，如 *invoice*，不区分大小写
+	NameRegex    string   `json:"name_regex,omitempty"`    // 文件名正则表达式
+	MinSize      int64    `json:"min_size,omitempty"`      // 最小字节数（含），文件夹按其中文件的总大小计算
+	MaxSize      int64    `json:"max_size,omitempty"`      // 最大字节数（含）
+	MinAgeHours  float64  `json:"min_age_hours,omitempty"` // 距最后修改至少多少小时
+	MaxAgeHours  float64  `json:"max_age_hours,omitempty"` // 距最后修改至多多少小时
+	SourcePrefix string   `json:"source_prefix,omitempty"` // 文件所在目录须位于该目录下（含子目录），支持 ~
+	Hidden       *bool    `json:"hidden,omitempty"`        // true 只匹配隐藏文件，false 只匹配非隐藏文件
+	Extensions   []string `json:"extensions,omitempty"`    // 扩展名之一，主要用于条件树
+	FileTypes    []string `json:"file_types,omitempty"`    // 文件类型之一，主要用于条件树
+	MIMETypes    []string `json:"mime_types,omitempty"`    // 按文件头识别的 MIME 类型之一，支持 image/* 通配
+}
+
+// ConditionNode 条件树节点，all、any、not、match 中必须恰好设置一个
+type ConditionNode struct {
+	All   []ConditionNode `json:"all,omitempty"`   // 全部子节点满足
+	Any   []ConditionNode `json:"any,omitempty"`   // 任一子节点满足
+	Not   *ConditionNode  `json:"not,omitempty"`   // 子节点不满足
+	Match *RuleConditions `json:"match,omitempty"` // 叶子条件，其中设置的各项同时满足
+}
+
+// RuleTestRequest 规则测试请求，file_path（已有文件）与 file（虚拟文件）二选一
+type RuleTestRequest struct {
+	FilePath string        `json:"file_path,omitempty"`
+	File     *RuleTestFile `json:"file,omitempty"`
+}
+
+// RuleTestFile 虚拟文件描述，用于测试尚不存在的文件
+type RuleTestFile struct {
+	Name     string  `json:"name"`                // 文件名（含扩展名）
+	Dir      string  `json:"dir,omitempty"`       // 所在目录，支持 ~，默认为用户主目录
+	Size     int64   `json:"size"`                // 字节数
+	AgeHours float64 `json:"age_hours"`           // 距最后修改的小时数
+	MIMEType string  `json:"mime_type,omitempty"` // 文件内容的 MIME 类型，为空时只按扩展名判断类型
+	IsDir    bool    `json:"is_dir"`
+}
+
+// RuleTestFacts 参与匹配的文件信息
+type RuleTestFacts struct {
+	Path     string  `json:"path"`
+	Name     string  `json:"name"`
+	Dir      string  `json:"dir"`
+	Ext      string  `json:"ext"`
+	FileType string  `json:"file_type"`
+	MIMEType string  `json:"mime_type"`
+	Size     int64   `json:"size"`
+	AgeHours float64 `json:"age_hours"`
+	Hidden   bool    `json:"hidden"`
+	IsDir    bool    `json:"is_dir"`
+}
+
+// ConditionCheck 一项条件的判断结果
+type ConditionCheck struct {
+	Condition string `json:"condition"` // 条件路径，如 conditions.min_size、condition_tree.any[0].match.extensions
+	Passed    bool   `json:"passed"`
+	Detail    string `json:"detail"` // 实际取值与要求
+}
+
+// RuleEvaluation 单条规则对文件的判断结果
+type RuleEvaluation struct {
+	RuleID   string           `json:"rule_id"`
+	RuleName string           `json:"rule_name"`
+	Priority int              `json:"priority"`
+	Enabled  bool             `json:"enabled"`
+	CatchAll bool             `json:"catch_all"`
+	Matched  bool             `json:"matched"` // 启用且全部条件满足
+	Checks   []ConditionCheck `json:"checks"`
+}
+
+// RuleTestResult 规则测试结果：每条规则的判断过程、生效的规则与预期的名称和目标位置
+type RuleTestResult struct {
+	File        RuleTestFacts    `json:"file"`
+	Rules       []RuleEvaluation `json:"rules"`
+	RuleID      string           `json:"rule_id,omitempty"` // 生效的规则，没有匹配时为空并使用默认规则
+	RuleUsed    string           `json:"rule_used"`
+	Action      string           `json:"action"`
+	NewName     string           `json:"new_name"`
+	Destination string           `json:"destination"`
+	Notes       []string         `json:"notes,omitempty"` // 预览与实际处理可能不同的原因，如未执行 AI 分析
+}
+
+// RuleBundle 规则包，用于在不同机器之间导出、导入规则
+type RuleBundle struct {
+	Version    int    `json:"version"`
+	ExportedAt string `json:"exported_at,omitempty"`
+	Rules      []Rule `json:"rules"`
+}
+
+// RuleImportItem 规则包中一条规则（或 replace 模式下被删除的现有规则）的导入结果
+type RuleImportItem struct {
+	Index      int    `json:"index"`               // 在规则包中的位置，被删除的现有规则为 -1
+	BundleID   string `json:"bundle_id,omitempty"` // 规则包中的 ID
+	Name       string `json:"name"`
+	Operation  string `json:"operation"`             // create, update, skip or delete
+	RuleID     string `json:"rule_id,omitempty"`     // 导入后在本机的 ID
+	Conflict   string `json:"conflict,omitempty"`    // 与现有规则的冲突：id 或 name
+	ExistingID string `json:"existing_id,omitempty"` // 冲突的现有规则
+	Message    string `json:"message,omitempty"`
+}
+
+// RuleImportResult 规则导入结果，dry_run 时只预览不写入
+type RuleImportResult struct {
+	Version    int               `json:"version"`
+	Mode       string            `json:"mode"`        // merge or replace
+	OnConflict string            `json:"on_conflict"` // merge 模式下同 ID 或同名规则的处理：skip, overwrite or copy
+	DryRun     bool              `json:"dry_run"`
+	Force      bool              `json:"force"` // replace 模式下删除仍被引用的规则，并停用、解除这些引用
+	Items      []RuleImportItem  `json:"items"`
+	IDMap      map[string]string `json:"id_map"` // 规则包中的 ID -> 本机 ID
+	Created    int               `json:"created"`
+	Updated    int               `json:"updated"`
+	Skipped    int               `json:"skipped"`
+	Deleted    int               `json:"deleted"`
+}
+
+// RuleOrderRequest 调整规则顺序请求，需包含全部规则 ID
+type RuleOrderRequest struct {
+	RuleIDs []string `json:"rule_ids" binding:"required"`
+}
+
+// RuleStep 规则处理流水线中的一个步骤，不同类型使用的参数不同
+type RuleStep struct {
+	Type           string   `json:"type"`                      // rename, copy, move, symlink, hardlink, clone, extract, compress, sidecar or webhook
+	Destination    string   `json:"destination,omitempty"`     // 目标目录，支持占位符（copy、move、symlink、hardlink、clone、extract、compress）
+	NameTemplate   []string `json:"name_template,omitempty"`   // 新名称模板；rename 为空时使用规则的命名，其他步骤为空时沿用当前名称
+	ConflictPolicy string   `json:"conflict_policy,omitempty"` // 为空时使用规则的冲突处理策略
+	ArchiveFormat  string   `json:"archive_format,omitempty"`  // compress：zip or tar.gz
+	URL            string   `json:"url,omitempty"`             // webhook：接收通知的地址
+	OnError        string   `json:"on_error,omitempty"`        // abort（默认）, continue or rollback
+}
+
+// PlanStep 流水线步骤的执行计划（占位符已展开）
+type PlanStep struct {
+	Type           string `json:"type"`
+	Destination    string `json:"destination,omitempty"`
+	Name           string `json:"name,omitempty"` // 生成的名称（不含扩展名），为空时沿用当前名称
+	ConflictPolicy string `json:"conflict_policy,omitempty"`
+	ArchiveFormat  string `json:"archive_format,omitempty"`
+	URL            string `json:"url,omitempty"`
+	OnError        string `json:"on_error"`
+}
+
+// StepResult 流水线步骤的执行结果，撤销时按相反顺序还原
+type StepResult struct {
+	Index       int    `json:"index"`
+	Type        string `json:"type"`
+	Status      string `json:"status"`           // success, skipped, failed, rolled_back or not_run
+	Source      string `json:"source,omitempty"` // 步骤执行时的当前文件
+	Output      string `json:"output,omitempty"` // 步骤生成或移动到的位置
+	ContentHash string `json:"content_hash,omitempty"`
+	Message     string `json:"message,omitempty"`
 }
@@ -14,17 +14,56 @@ func SetupRoutes(r *gin.Engine) {
 		// 系统相关
 		api.GET("/health", handlers.Health)
 		api.GET("/status", handlers.Status)
+		api.GET("/events", handlers.StreamEvents)
 
 		// 文件处理
 		api.POST("/files/process", handlers.ProcessFile)
+		api.POST("/files/plan", handlers.PlanFile)
+
+		// 批量任务
+		api.POST("/jobs", handlers.CreateJob)
+		api.GET("/jobs", handlers.GetJobs)
+		api.GET("/jobs/:id", handlers.GetJob)
+		api.POST("/jobs/:id/pause", handlers.PauseJob)
+		api.POST("/jobs/:id/resume", handlers.ResumeJob)
+		api.POST("/jobs/:id/cancel", handlers.CancelJob)
+		api.DELETE("/jobs/:id", handlers.CancelJob)
+
+		// 监听文件夹
+		api.GET("/watch-folders", handlers.GetWatchFolders)
+		api.POST("/watch-folders", handlers.CreateWatchFolder)
+		api.PUT("/watch-folders/:id", handlers.UpdateWatchFolder)
+		api.DELETE("/watch-folders/:id", handlers.DeleteWatchFolder)
+
+		// 定时整理
+		api.GET("/schedules", handlers.GetSchedules)
+		api.POST("/schedules", handlers.CreateSchedule)
+		api.PUT("/schedules/:id", handlers.UpdateSchedule)
+		api.DELETE("/schedules/:id", handlers.DeleteSchedule)
+		api.POST("/schedules/:id/run", handlers.RunSchedule)
+		api.GET("/schedules/:id/runs", handlers.GetScheduleRuns)
+
+		// Webhook
+		api.GET("/webhooks", handlers.GetWebhooks)
+		api.POST("/webhooks", handlers.CreateWebhook)
+		api.PUT("/webhooks/:id", handlers.UpdateWebhook)
+		api.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+		api.POST("/webhooks/:id/test", handlers.TestWebhook)
+		api.GET("/webhooks/:id/deliveries", handlers.GetWebhookDeliveries)
 
 		// 历史记录
 		api.GET("/history", handlers.GetHistory)
 		api.POST("/history/clear", handlers.ClearHistory)
+		api.POST("/history/undo", handlers.UndoHistoryBatch)
+		api.POST("/history/:id/undo", handlers.UndoHistory)
 
 		// 规则管理
 		api.GET("/rules", handlers.GetRules)
 		api.POST("/rules", handlers.CreateRule)
+		api.PUT("/rules/order", handlers.ReorderRules)
+		api.POST("/rules/test", handlers.TestRules)
+		api.GET("/rules/export", handlers.ExportRules)
+		api.POST("/rules/import", handlers.ImportRules)
 		api.PUT("/rules/:id", handlers.UpdateRule)
 		api.DELETE("/rules/:id", handlers.DeleteRule)
 
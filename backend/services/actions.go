@@ -0,0 +1,191 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 规则动作
+const (
+	ActionCopy     = "copy"
+	ActionMove     = "move"
+	ActionSymlink  = "symlink"  // 原文件保留在原处，在目标位置创建符号链接
+	ActionHardlink = "hardlink" // 在目标位置创建硬链接，要求同一文件系统
+	ActionClone    = "clone"    // 写时复制克隆（reflink），不支持时回退为复制
+	ActionInPlace  = "in_place" // 不移动位置，只在原文件所在目录内重命名
+	ActionExtract  = "extract"  // 将压缩包解压到以模板命名的文件夹，保留压缩包
+	ActionCompress = "compress" // 将文件或文件夹打包为 zip 或 tar.gz，保留原文件
+)
+
+// 克隆方式（记录在历史记录的元数据中）
+const (
+	CloneReflink = "reflink"
+	CloneCopied  = "copied"
+)
+
+// ErrActionUnsupported 当前文件无法执行规则指定的动作
+var ErrActionUnsupported = errors.New("无法执行该动作")
+
+// IsValidAction 判断规则动作是否合法（空值表示复制）
+func IsValidAction(action string) bool {
+	switch action {
+	case "", ActionCopy, ActionMove, ActionSymlink, ActionHardlink, ActionClone, ActionInPlace,
+		ActionExtract, ActionCompress:
+		return true
+	default:
+		return false
+	}
+}
+
+// movesOriginal 判断动作执行后原路径是否不再存在
+func movesOriginal(action string) bool {
+	return action == ActionMove || action == ActionInPlace
+}
+
+// validateAction 在生成计划时检查动作能否执行，例如硬链接不能用于文件夹或跨设备
+func validateAction(action string, src string, info os.FileInfo, destDir string) error {
+	if info.IsDir() && isInsideSource(src, destDir) {
+		return fmt.Errorf("%w: 目标目录 %s 位于文件夹 %s 之内", ErrActionUnsupported, destDir, src)
+	}
+	if action == ActionExtract {
+		if info.IsDir() || ArchiveFormatOf(src) == "" {
+			return fmt.Errorf("%w: %s 不是支持的压缩包（zip、tar、tar.gz、tar.bz2）", ErrActionUnsupported, filepath.Base(src))
+		}
+		return nil
+	}
+	if action != ActionHardlink {
+		return nil
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w: 文件夹不能创建硬链接", ErrActionUnsupported)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: 只有普通文件可以创建硬链接", ErrActionUnsupported)
+	}
+	existing := nearestExistingDir(destDir)
+	if !sameDevice(src, existing) {
+		return fmt.Errorf("%w: 硬链接不能跨设备（%s 与 %s 不在同一文件系统）", ErrActionUnsupported, src, existing)
+	}
+	return nil
+}
+
+// isInsideSource 判断目标目录是否为源文件夹自身或其子目录（包括经由符号链接指向其中），
+// 复制或打包到这样的位置会把正在写入的结果再次读入
+func isInsideSource(src, destDir string) bool {
+	if isWithinDir(destDir, src) {
+		return true
+	}
+	realSrc, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return false
+	}
+	realDest, err := filepath.EvalSymlinks(nearestExistingDir(destDir))
+	return err == nil && isWithinDir(realDest, realSrc)
+}
+
+// nearestExistingDir 返回路径自身或最近一个已存在的上级目录
+func nearestExistingDir(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// SymlinkPath 在目标位置创建指向原文件（绝对路径）的符号链接
+func SymlinkPath(src, dst string) error {
+	target, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	return placeLink(dst, func(tmp string) error {
+		return os.Symlink(target, tmp)
+	})
+}
+
+// HardlinkPath 在目标位置创建原文件的硬链接
+func HardlinkPath(src, dst string) error {
+	return placeLink(dst, func(tmp string) error {
+		return os.Link(src, tmp)
+	})
+}
+
+// placeLink 先在目标目录中以临时名称创建链接，再重命名到位（覆盖策略下替换已有文件）
+func placeLink(dst string, create func(tmp string) error) error {
+	tmp := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".%s.%d.link.tmp", filepath.Base(dst), os.Getpid()))
+	os.Remove(tmp)
+	if err := create(tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(dst))
+	return nil
+}
+
+// ClonePath 克隆文件或文件夹，返回实际使用的方式：全部通过 reflink 完成为 CloneReflink，
+// 否则（文件系统不支持、跨设备等）回退为普通复制，返回 CloneCopied
+func ClonePath(src, dst string, progress ProgressFunc) (string, error) {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return "", err
+	}
+
+	method := CloneReflink
+	cloneOne := func(src, dst string, progress ProgressFunc) error {
+		if err := cloneFile(src, dst); err == nil {
+			if progress != nil {
+				if info, err := os.Stat(dst); err == nil {
+					progress(info.Size(), info.Size())
+				}
+			}
+			return nil
+		}
+		method = CloneCopied
+		return CopyFileWithProgress(src, dst, progress)
+	}
+
+	if info.IsDir() {
+		err = copyDirWith(src, dst, progress, cloneOne)
+	} else {
+		err = cloneOne(src, dst, progress)
+	}
+	if err != nil {
+		return "", err
+	}
+	return method, nil
+}
+
+// cloneFile 以 reflink 方式克隆单个文件：先克隆到目标目录中的临时文件，成功后再重命名到位
+func cloneFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".%s.%d.clone.tmp", filepath.Base(dst), os.Getpid()))
+	os.Remove(tmp)
+	if err := reflink(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(dst))
+	return nil
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"main/models"
+)
+
+// AI 并发限制
+const (
+	DefaultAIConcurrency = 2  // 未配置 max_concurrency 时每个提供商同时进行的分析数
+	MaxAIConcurrency     = 32 // max_concurrency 的上限
+)
+
+// aiLimiter 单个提供商的并发限制，超出限制的请求按到达顺序排队
+type aiLimiter struct {
+	active  int
+	waiters *list.List // 元素为 chan struct{}，获得名额时关闭
+}
+
+// aiFlight 一次正在进行的模型调用，相同文件的请求共享其结果
+type aiFlight struct {
+	key      string // 提供商、模型与文件路径、大小、修改时间
+	prefix   string // 提供商与模型
+	path     string
+	size     int64 // 无法读取文件信息时为 -1
+	hashOnce sync.Once
+	hash     string // 内容哈希，只在其他文件大小相同时才计算
+	waiters  int
+	cancel   context.CancelFunc
+	done     chan struct{}
+	analysis *models.AIAnalysis
+	err      error
+}
+
+// aiScheduler 按提供商限制并发，并合并对同一文件（路径与版本相同，或内容相同）的重复分析
+type aiScheduler struct {
+	mu       sync.Mutex
+	limiters map[string]*aiLimiter
+	flights  map[string]*aiFlight
+}
+
+var aiQueue = &aiScheduler{
+	limiters: make(map[string]*aiLimiter),
+	flights:  make(map[string]*aiFlight),
+}
+
+// aiConcurrency 提供商允许的并发数，max_concurrency 只作用于当前配置的提供商
+func aiConcurrency(provider string) int {
+	if config := CurrentAIConfig(); provider == config.Provider && config.MaxConcurrency > 0 {
+		return config.MaxConcurrency
+	}
+	return DefaultAIConcurrency
+}
+
+func (s *aiScheduler) limiter(provider string) *aiLimiter {
+	l, ok := s.limiters[provider]
+	if !ok {
+		l = &aiLimiter{waiters: list.New()}
+		s.limiters[provider] = l
+	}
+	return l
+}
+
+// acquire 获取提供商的一个名额，排队期间 ctx 取消则放弃排队
+func (s *aiScheduler) acquire(ctx context.Context, provider string) error {
+	s.mu.Lock()
+	l := s.limiter(provider)
+	if l.active < aiConcurrency(provider) && l.waiters.Len() == 0 {
+		l.active++
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	elem := l.waiters.PushBack(ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-ready:
+			// 取消的同时已获得名额，让给下一个排队者
+			l.active--
+			s.admit(provider, l)
+		default:
+			l.waiters.Remove(elem)
+		}
+		return cancelledError(ctx)
+	}
+}
+
+// release 归还名额并唤醒排队者
+func (s *aiScheduler) release(provider string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.limiter(provider)
+	l.active--
+	s.admit(provider, l)
+}
+
+// admit 在名额允许时按 FIFO 顺序放行排队者，调用方需持有锁
+func (s *aiScheduler) admit(provider string, l *aiLimiter) {
+	for l.active < aiConcurrency(provider) && l.waiters.Len() > 0 {
+		ready := l.waiters.Remove(l.waiters.Front()).(chan struct{})
+		l.active++
+		close(ready)
+	}
+}
+
+// reconfigure 并发数调整后放行可以开始的排队者
+func (s *aiScheduler) reconfigure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for provider, l := range s.limiters {
+		s.admit(provider, l)
+	}
+}
+
+// analyze 合并相同文件的分析请求：先按路径、大小与修改时间查找进行中的调用；没有时，
+// 只有存在大小相同的其他调用才计算内容哈希确认是否相同，避免每次分析都完整读取大文件。
+// 都没有时发起新的调用。调用使用独立的 ctx，只有所有等待者都取消后才会被取消。
+// 调用使用发起时的 AI 配置，之后修改配置只影响新的调用
+func (s *aiScheduler) analyze(ctx context.Context, filePath, model string) (*models.AIAnalysis, error) {
+	config := CurrentAIConfig()
+	if model == "" {
+		model = config.Model
+	}
+	provider := config.Provider
+	prefix := provider + "\x00" + model + "\x00"
+	size := int64(-1)
+	key := prefix + filePath
+	if info, err := os.Stat(filePath); err == nil && !info.IsDir() {
+		size = info.Size()
+		key = fmt.Sprintf("%s%s\x00%d\x00%d", prefix, filePath, size, info.ModTime().UnixNano())
+	}
+
+	s.mu.Lock()
+	flight := s.flights[key]
+	if flight == nil {
+		var sameContent *aiFlight
+		if candidates := s.sameSizeFlights(prefix, filePath, size); len(candidates) > 0 {
+			s.mu.Unlock()
+			if hash, err := HashFile(filePath); err == nil {
+				for _, candidate := range candidates {
+					if candidate.contentHash() == hash {
+						sameContent = candidate
+						break
+					}
+				}
+			}
+			s.mu.Lock()
+		}
+
+		switch {
+		case s.flights[key] != nil:
+			flight = s.flights[key]
+		case sameContent != nil && s.flights[sameContent.key] == sameContent:
+			flight = sameContent
+		default:
+			flightCtx, cancel := context.WithCancel(context.Background())
+			flight = &aiFlight{
+				key:    key,
+				prefix: prefix,
+				path:   filePath,
+				size:   size,
+				cancel: cancel,
+				done:   make(chan struct{}),
+			}
+			s.flights[key] = flight
+			go s.run(flightCtx, flight, config, filePath, model)
+		}
+	}
+	flight.waiters++
+	s.mu.Unlock()
+
+	select {
+	case <-flight.done:
+		return flight.analysis, flight.err
+	case <-ctx.Done():
+		s.mu.Lock()
+		flight.waiters--
+		if flight.waiters == 0 {
+			// 没有人再等待结果，之后的请求重新发起调用
+			s.removeFlight(flight)
+			flight.cancel()
+		}
+		s.mu.Unlock()
+		return nil, cancelledError(ctx)
+	}
+}
+
+// sameSizeFlights 进行中的、同一提供商和模型下大小相同的其他文件的调用，调用方需持有锁
+func (s *aiScheduler) sameSizeFlights(prefix, filePath string, size int64) []*aiFlight {
+	if size < 0 {
+		return nil
+	}
+	var candidates []*aiFlight
+	for _, flight := range s.flights {
+		if flight.prefix == prefix && flight.size == size && flight.path != filePath {
+			candidates = append(candidates, flight)
+		}
+	}
+	return candidates
+}
+
+// contentHash 调用对应文件的内容哈希，首次需要时计算；读取失败时为空
+func (f *aiFlight) contentHash() string {
+	f.hashOnce.Do(func() {
+		f.hash, _ = HashFile(f.path)
+	})
+	return f.hash
+}
+
+// removeFlight 移除合并记录，之后的请求不再加入该调用，调用方需持有锁
+func (s *aiScheduler) removeFlight(flight *aiFlight) {
+	if s.flights[flight.key] == flight {
+		delete(s.flights, flight.key)
+	}
+}
+
+// run 排队获取名额后调用模型，结束后移除合并记录
+func (s *aiScheduler) run(ctx context.Context, flight *aiFlight, config models.AIConfig, filePath, model string) {
+	defer func() {
+		s.mu.Lock()
+		s.removeFlight(flight)
+		s.mu.Unlock()
+		flight.cancel()
+		close(flight.done)
+	}()
+
+	if err := s.acquire(ctx, config.Provider); err != nil {
+		flight.err = err
+		return
+	}
+	defer s.release(config.Provider)
+
+	flight.analysis, flight.err = analyzeFile(ctx, config, filePath, model)
+}
+
+// stats 各提供商的并发与排队情况
+func (s *aiScheduler) stats() models.AIQueueStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	providers := make([]models.AIProviderQueue, 0, len(s.limiters))
+	for provider, l := range s.limiters {
+		providers = append(providers, models.AIProviderQueue{
+			Provider: provider,
+			Limit:    aiConcurrency(provider),
+			Active:   l.active,
+			Queued:   l.waiters.Len(),
+		})
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Provider < providers[j].Provider })
+
+	return models.AIQueueStats{Providers: providers, InFlight: len(s.flights)}
+}
+
+// ReconfigureAI 应用新的 AI 配置，并按新的并发数放行排队中的请求
+func ReconfigureAI(config models.AIConfig) {
+	aiConfigMu.Lock()
+	globalAIConfig = config
+	aiConfigMu.Unlock()
+	aiQueue.reconfigure()
+}
+
+// GetAIQueueStats 获取 AI 分析的并发与排队情况
+func GetAIQueueStats() models.AIQueueStats {
+	return aiQueue.stats()
+}
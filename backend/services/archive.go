@@ -0,0 +1,651 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 压缩包格式
+const (
+	ArchiveZip    = "zip"
+	ArchiveTar    = "tar"
+	ArchiveTarGz  = "tar.gz"
+	ArchiveTarBz2 = "tar.bz2"
+)
+
+// 解压限制，防止解压炸弹
+const (
+	maxExtractSize    int64 = 8 << 30 // 解压后的总字节数
+	maxExtractEntries       = 100000  // 条目数
+	maxSymlinkTarget        = 4096    // zip 中符号链接目标的长度
+	maxSymlinkHops          = 40      // 解析符号链接时最多跟随的次数
+)
+
+// ErrArchiveUnsafe 压缩包中的路径或链接指向解压目录之外
+var ErrArchiveUnsafe = errors.New("压缩包包含不安全的路径")
+
+// ErrArchiveTooLarge 压缩包超出解压限制
+var ErrArchiveTooLarge = errors.New("压缩包超出解压限制")
+
+// archiveSuffixes 文件名后缀与压缩包格式的对应关系，复合后缀在前
+var archiveSuffixes = []struct {
+	suffix string
+	format string
+}{
+	{".tar.gz", ArchiveTarGz},
+	{".tgz", ArchiveTarGz},
+	{".tar.bz2", ArchiveTarBz2},
+	{".tbz2", ArchiveTarBz2},
+	{".tbz", ArchiveTarBz2},
+	{".tar", ArchiveTar},
+	{".zip", ArchiveZip},
+}
+
+// ArchiveFormatOf 根据文件名判断压缩包格式，不支持时返回空
+func ArchiveFormatOf(name string) string {
+	lower := strings.ToLower(name)
+	for _, item := range archiveSuffixes {
+		if strings.HasSuffix(lower, item.suffix) {
+			return item.format
+		}
+	}
+	return ""
+}
+
+// trimArchiveExt 去掉压缩包的（复合）扩展名
+func trimArchiveExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, item := range archiveSuffixes {
+		if strings.HasSuffix(lower, item.suffix) {
+			return name[:len(name)-len(item.suffix)]
+		}
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// IsValidCompressFormat 判断压缩格式是否合法（空值表示 zip）
+func IsValidCompressFormat(format string) bool {
+	switch format {
+	case "", ArchiveZip, ArchiveTarGz:
+		return true
+	default:
+		return false
+	}
+}
+
+// ExtractArchive 将压缩包解压到目标目录：先解压到旁边的临时目录，全部成功后再重命名到位。
+// 返回解压的条目数
+func ExtractArchive(src, dst string, progress ProgressFunc) (int, error) {
+	format := ArchiveFormatOf(src)
+	if format == "" {
+		return 0, fmt.Errorf("%w: 不支持的压缩格式 %s", ErrActionUnsupported, filepath.Base(src))
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		os.RemoveAll(tmpDir)
+		return 0, err
+	}
+
+	x := &extractor{root: tmpDir}
+	if format == ArchiveZip {
+		err = x.extractZip(src, progress)
+	} else {
+		err = x.extractTar(src, format, progress)
+	}
+	if err == nil {
+		err = x.checkLinks()
+	}
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return 0, err
+	}
+
+	if err := replaceDir(tmpDir, dst); err != nil {
+		os.RemoveAll(tmpDir)
+		return 0, err
+	}
+	syncDir(filepath.Dir(dst))
+	return x.entries, nil
+}
+
+// extractor 解压到 root 目录，所有写入都校验路径不会超出 root
+type extractor struct {
+	root    string
+	written int64
+	entries int
+	links   []string // 已创建的符号链接，解压完成后统一检查实际指向
+}
+
+// target 将条目名转换为解压目录内的路径，拒绝绝对路径和 ".."
+func (x *extractor) target(name string) (string, error) {
+	x.entries++
+	if x.entries > maxExtractEntries {
+		return "", fmt.Errorf("%w: 条目数超过 %d", ErrArchiveTooLarge, maxExtractEntries)
+	}
+
+	name = strings.TrimSuffix(strings.ReplaceAll(name, `\`, "/"), "/")
+	local := filepath.FromSlash(name)
+	if name == "" || !filepath.IsLocal(local) {
+		return "", fmt.Errorf("%w: %s", ErrArchiveUnsafe, name)
+	}
+	return filepath.Join(x.root, local), nil
+}
+
+// checkParents 确认 target 在解压目录内的各级上级目录都不是符号链接。
+// MkdirAll 与 OpenFile 会跟随前面条目创建的链接，只比较路径字符串无法阻止写到解压目录之外
+func (x *extractor) checkParents(target string) error {
+	rel, err := filepath.Rel(x.root, filepath.Dir(target))
+	if err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%w: %s", ErrArchiveUnsafe, target)
+	}
+	if rel == "." {
+		return nil
+	}
+
+	current := x.root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			rel, _ := filepath.Rel(x.root, current)
+			return fmt.Errorf("%w: 路径经过符号链接 %s", ErrArchiveUnsafe, filepath.ToSlash(rel))
+		}
+		if !info.IsDir() {
+			return nil
+		}
+	}
+	return nil
+}
+
+// replaceExisting 压缩包中重复出现的条目以后出现的为准：删除之前解压的同名文件或符号链接
+// （删除链接本身，不跟随）。解压目录是新建的，其中只有本压缩包的内容
+func (x *extractor) replaceExisting(target string) error {
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		rel, _ := filepath.Rel(x.root, target)
+		return fmt.Errorf("%w: 条目 %s 与已解压的文件夹同名", ErrArchiveUnsafe, filepath.ToSlash(rel))
+	}
+	return os.Remove(target)
+}
+
+func (x *extractor) mkdir(target string) error {
+	if err := x.checkParents(target); err != nil {
+		return err
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+// writeFile 写入普通文件，按实际写入的字节数（而不是条目声明的大小）检查总大小
+func (x *extractor) writeFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := x.checkParents(target); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := x.replaceExisting(target); err != nil {
+		return err
+	}
+	// O_EXCL 避免写穿同名的符号链接
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(file, io.LimitReader(r, maxExtractSize-x.written+1))
+	x.written += n
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if x.written > maxExtractSize {
+		return fmt.Errorf("%w: 解压后超过 %d 字节", ErrArchiveTooLarge, maxExtractSize)
+	}
+	return nil
+}
+
+// symlink 创建符号链接，链接目标必须是解压目录内的相对路径。
+// 链接目标可能经过之后条目创建的链接，实际指向在解压完成后由 checkLinks 检查
+func (x *extractor) symlink(target, linkname string) error {
+	if filepath.IsAbs(linkname) {
+		return fmt.Errorf("%w: 链接 %s 指向绝对路径", ErrArchiveUnsafe, linkname)
+	}
+	resolved := filepath.Join(filepath.Dir(target), filepath.FromSlash(linkname))
+	if rel, err := filepath.Rel(x.root, resolved); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%w: 链接 %s 指向解压目录之外", ErrArchiveUnsafe, linkname)
+	}
+	if err := x.checkParents(target); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := x.replaceExisting(target); err != nil {
+		return err
+	}
+	if err := os.Symlink(linkname, target); err != nil {
+		return err
+	}
+	x.links = append(x.links, target)
+	return nil
+}
+
+// checkLinks 逐级解析已创建的符号链接，任何一条经由其他链接指向解压目录之外时拒绝整个压缩包
+func (x *extractor) checkLinks() error {
+	for _, link := range x.links {
+		hops := 0
+		if _, err := x.resolve(filepath.Dir(link), filepath.Base(link), &hops); err != nil {
+			rel, _ := filepath.Rel(x.root, link)
+			return fmt.Errorf("%w: 链接 %s 指向解压目录之外", ErrArchiveUnsafe, filepath.ToSlash(rel))
+		}
+	}
+	return nil
+}
+
+// resolve 从 dir 出发按实际文件系统解析相对路径 path，跟随途中的符号链接，不存在的部分按字面处理。
+// 每一步都必须留在解压目录内
+func (x *extractor) resolve(dir, path string, hops *int) (string, error) {
+	current := dir
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+		default:
+			next := filepath.Join(current, part)
+			info, err := os.Lstat(next)
+			if err == nil && info.Mode()&os.ModeSymlink != 0 {
+				*hops++
+				if *hops > maxSymlinkHops {
+					return "", ErrArchiveUnsafe
+				}
+				linkname, err := os.Readlink(next)
+				if err != nil {
+					return "", err
+				}
+				if filepath.IsAbs(linkname) {
+					return "", ErrArchiveUnsafe
+				}
+				if next, err = x.resolve(current, linkname, hops); err != nil {
+					return "", err
+				}
+			}
+			current = next
+		}
+		if !isWithinDir(current, x.root) {
+			return "", ErrArchiveUnsafe
+		}
+	}
+	return current, nil
+}
+
+func (x *extractor) extractZip(src string, progress ProgressFunc) error {
+	reader, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	total := int64(len(reader.File))
+	for i, file := range reader.File {
+		target, err := x.target(file.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.mkdir(target)
+		case mode&os.ModeSymlink != 0:
+			err = x.extractZipSymlink(file, target)
+		case mode.IsRegular():
+			err = x.extractZipFile(file, target)
+		default:
+			log.Printf("跳过特殊文件: %s", file.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if progress != nil {
+			progress(int64(i+1), total)
+		}
+	}
+	return nil
+}
+
+func (x *extractor) extractZipFile(file *zip.File, target string) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return x.writeFile(target, rc, file.Mode())
+}
+
+func (x *extractor) extractZipSymlink(file *zip.File, target string) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	link, err := io.ReadAll(io.LimitReader(rc, maxSymlinkTarget))
+	if err != nil {
+		return err
+	}
+	return x.symlink(target, string(link))
+}
+
+func (x *extractor) extractTar(src, format string, progress ProgressFunc) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// 按读取的压缩包字节数计算进度
+	var r io.Reader = &progressReader{reader: file, total: info.Size(), progress: progress}
+	switch format {
+	case ArchiveTarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case ArchiveTarBz2:
+		r = bzip2.NewReader(r)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := x.target(header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(target)
+		case tar.TypeReg, tar.TypeRegA:
+			err = x.writeFile(target, tr, header.FileInfo().Mode())
+		case tar.TypeSymlink:
+			err = x.symlink(target, header.Linkname)
+		case tar.TypeLink:
+			err = x.hardlink(target, header.Linkname)
+		default:
+			log.Printf("跳过特殊文件: %s", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// hardlink tar 中的硬链接按复制已解压的文件处理
+func (x *extractor) hardlink(target, linkname string) error {
+	name := strings.TrimSuffix(strings.ReplaceAll(linkname, `\`, "/"), "/")
+	local := filepath.FromSlash(name)
+	if name == "" || !filepath.IsLocal(local) {
+		return fmt.Errorf("%w: 链接 %s 指向解压目录之外", ErrArchiveUnsafe, linkname)
+	}
+
+	// 源文件及其上级目录都不能是符号链接，否则可能读到解压目录之外的文件
+	sourcePath := filepath.Join(x.root, local)
+	if err := x.checkParents(sourcePath); err != nil {
+		return err
+	}
+	info, err := os.Lstat(sourcePath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: 链接 %s 不是普通文件", ErrArchiveUnsafe, linkname)
+	}
+
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	return x.writeFile(target, source, info.Mode())
+}
+
+// CompressPath 将文件或文件夹打包为 zip 或 tar.gz：先写入目标旁的临时文件，完成后再重命名到位。
+// 返回打包的条目数
+func CompressPath(src, dst, format string, progress ProgressFunc) (int, error) {
+	if format == "" {
+		format = ArchiveZip
+	}
+	if !IsValidCompressFormat(format) {
+		return 0, fmt.Errorf("%w: 不支持的压缩格式 %s", ErrActionUnsupported, format)
+	}
+
+	total, err := PathSize(src)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	tmpPath := tmp.Name()
+
+	var written int64
+	onWrite := func(n int64) {
+		written += n
+		if progress != nil {
+			progress(written, total)
+		}
+	}
+
+	var entries int
+	if format == ArchiveZip {
+		entries, err = writeZip(tmp, src, onWrite, tmpPath, dst)
+	} else {
+		entries, err = writeTarGz(tmp, src, onWrite, tmpPath, dst)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, dst)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	syncDir(filepath.Dir(dst))
+	return entries, nil
+}
+
+// walkArchiveEntries 遍历待打包的条目，条目名以源文件（夹）名开头，使用 / 分隔。
+// exclude 为正在写入的临时文件与目标路径，位于源文件夹内时不能被打包进自身
+func walkArchiveEntries(src string, fn func(path, name string, info os.FileInfo) error, exclude ...string) error {
+	base := filepath.Base(src)
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		for _, excluded := range exclude {
+			if filepath.Clean(path) == filepath.Clean(excluded) {
+				return nil
+			}
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(base, rel))
+		if !info.IsDir() && !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			log.Printf("跳过特殊文件: %s", path)
+			return nil
+		}
+		return fn(path, name, info)
+	})
+}
+
+// countingWriter 统计写入的源文件字节数
+type countingWriter struct {
+	writer  io.Writer
+	onWrite func(int64)
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.onWrite(int64(n))
+	return n, err
+}
+
+func writeZip(out io.Writer, src string, onWrite func(int64), exclude ...string) (int, error) {
+	zw := zip.NewWriter(out)
+	entries := 0
+
+	err := walkArchiveEntries(src, func(path, name string, info os.FileInfo) error {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		} else if info.Mode().IsRegular() {
+			header.Method = zip.Deflate
+		}
+
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		entries++
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, link)
+			return err
+		case info.Mode().IsRegular():
+			return copyFileTo(&countingWriter{writer: w, onWrite: onWrite}, path)
+		}
+		return nil
+	}, exclude...)
+	if err != nil {
+		zw.Close()
+		return 0, err
+	}
+	return entries, zw.Close()
+}
+
+func writeTarGz(out io.Writer, src string, onWrite func(int64), exclude ...string) (int, error) {
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	entries := 0
+
+	err := walkArchiveEntries(src, func(path, name string, info os.FileInfo) error {
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			link = target
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		entries++
+
+		if info.Mode().IsRegular() {
+			return copyFileTo(&countingWriter{writer: tw, onWrite: onWrite}, path)
+		}
+		return nil
+	}, exclude...)
+	if err != nil {
+		tw.Close()
+		gz.Close()
+		return 0, err
+	}
+	if err := tw.Close(); err != nil {
+		gz.Close()
+		return 0, err
+	}
+	return entries, gz.Close()
+}
+
+func copyFileTo(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
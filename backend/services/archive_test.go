@@ -0,0 +1,164 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testTarEntry 测试压缩包中的条目：link 非空时为符号链接，否则为内容为 content（为空时取 name）的普通文件
+type testTarEntry struct {
+	name    string
+	link    string
+	content string
+}
+
+// writeTestTar 按顺序写入条目
+func writeTestTar(t *testing.T, path string, entries []testTarEntry) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tw := tar.NewWriter(file)
+	for _, entry := range entries {
+		content := entry.content
+		if content == "" {
+			content = entry.name
+		}
+		header := &tar.Header{Name: entry.name, Mode: 0644}
+		if entry.link != "" {
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.link
+		} else {
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(content))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if entry.link == "" {
+			if _, err := tw.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractArchiveRejectsSymlinkEscape(t *testing.T) {
+	cases := []struct {
+		name    string
+		entries []testTarEntry
+	}{
+		{"write through earlier links", []testTarEntry{{name: "p", link: "."}, {name: "p/t", link: ".."}, {name: "t/escaped.txt"}}},
+		{"link through later link", []testTarEntry{{name: "q", link: "a/.."}, {name: "a", link: "."}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			base := t.TempDir()
+			src := filepath.Join(base, "in.tar")
+			writeTestTar(t, src, tc.entries)
+
+			dst := filepath.Join(base, "out", "extracted")
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ExtractArchive(src, dst, nil); !errors.Is(err, ErrArchiveUnsafe) {
+				t.Fatalf("ExtractArchive error = %v, want ErrArchiveUnsafe", err)
+			}
+			if _, err := os.Lstat(filepath.Join(base, "out", "escaped.txt")); !os.IsNotExist(err) {
+				t.Fatalf("escaped.txt written outside the extraction directory")
+			}
+			if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+				t.Fatalf("destination created for an unsafe archive")
+			}
+			leftovers, _ := os.ReadDir(filepath.Dir(dst))
+			if len(leftovers) != 0 {
+				t.Fatalf("temporary files left behind: %v", leftovers)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveKeepsInternalLinks(t *testing.T) {
+	base := t.TempDir()
+	src := filepath.Join(base, "in.tar")
+	writeTestTar(t, src, []testTarEntry{
+		{name: "lib/v1/data.txt"},
+		{name: "lib/current", link: "v1"},
+		{name: "bin/data", link: "../lib/current/data.txt"},
+	})
+
+	dst := filepath.Join(base, "extracted")
+	if _, err := ExtractArchive(src, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "bin", "data"))
+	if err != nil || string(data) != "lib/v1/data.txt" {
+		t.Fatalf("read through link = %q, %v", data, err)
+	}
+}
+
+func TestExtractArchiveReplacesDuplicateEntries(t *testing.T) {
+	base := t.TempDir()
+	src := filepath.Join(base, "in.tar")
+	writeTestTar(t, src, []testTarEntry{
+		{name: "a.txt", content: "old"},
+		{name: "link", link: "a.txt"},
+		{name: "a.txt", content: "new"},
+		{name: "link", content: "now a file"},
+	})
+
+	dst := filepath.Join(base, "extracted")
+	if _, err := ExtractArchive(src, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"a.txt": "new", "link": "now a file"} {
+		info, err := os.Lstat(filepath.Join(dst, name))
+		if err != nil || !info.Mode().IsRegular() {
+			t.Fatalf("%s: %v, %v", name, info, err)
+		}
+		data, _ := os.ReadFile(filepath.Join(dst, name))
+		if string(data) != want {
+			t.Fatalf("%s = %q, want %q", name, data, want)
+		}
+	}
+}
+
+func TestCompressPathSkipsOwnOutput(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "folder")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(src, "folder.zip")
+	entries, err := CompressPath(src, dst, ArchiveZip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.OpenReader(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	if entries != 2 || len(names) != 2 {
+		t.Fatalf("entries = %d, names = %v, want folder/ and folder/a.txt", entries, names)
+	}
+}
@@ -0,0 +1,448 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"main/database"
+	"main/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleBundleVersion 当前规则包格式版本
+const RuleBundleVersion = 1
+
+// 规则包格式
+const (
+	BundleJSON = "json"
+	BundleYAML = "yaml"
+)
+
+// 导入模式
+const (
+	ImportMerge   = "merge"   // 保留现有规则，规则包中的规则追加在后面
+	ImportReplace = "replace" // 规则列表替换为规则包中的规则
+)
+
+// merge 模式下与现有规则同 ID 或同名时的处理方式
+const (
+	ImportSkip      = "skip"      // 保留现有规则
+	ImportOverwrite = "overwrite" // 用规则包中的内容更新现有规则
+	ImportCopy      = "copy"      // 作为新规则导入
+)
+
+// 导入操作
+const (
+	ImportOpCreate = "create"
+	ImportOpUpdate = "update"
+	ImportOpSkip   = "skip"
+	ImportOpDelete = "delete"
+)
+
+// ErrRuleInUse replace 模式下要删除的规则仍被监听文件夹、定时整理或 webhook 引用
+var ErrRuleInUse = errors.New("规则仍被引用，使用 force=true 删除并停用引用它们的监听文件夹、定时整理与 webhook")
+
+// ErrInvalidBundle 规则包格式或内容无效
+var ErrInvalidBundle = errors.New("规则包无效")
+
+// ExportRules 导出规则包，ids 为空时导出全部规则。主目录下的路径写为 ~ 开头，便于在其他机器上使用
+func ExportRules(ids []string) (models.RuleBundle, error) {
+	rules, err := database.GetRules()
+	if err != nil {
+		return models.RuleBundle{}, err
+	}
+
+	selected := rules
+	if len(ids) > 0 {
+		byID := make(map[string]models.Rule, len(rules))
+		for _, rule := range rules {
+			byID[rule.ID] = rule
+		}
+		selected = make([]models.Rule, 0, len(ids))
+		for _, id := range ids {
+			rule, ok := byID[id]
+			if !ok {
+				return models.RuleBundle{}, fmt.Errorf("%w: %s", ErrRuleNotFound, id)
+			}
+			selected = append(selected, rule)
+		}
+	}
+
+	bundle := models.RuleBundle{
+		Version:    RuleBundleVersion,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Rules:      make([]models.Rule, 0, len(selected)),
+	}
+	for _, rule := range selected {
+		rule.Priority = 0
+		rule.CreatedAt = ""
+		rule.UpdatedAt = ""
+		mapRulePaths(&rule, portablePath)
+		bundle.Rules = append(bundle.Rules, rule)
+	}
+	return bundle, nil
+}
+
+// EncodeRuleBundle 按 json 或 yaml 格式输出规则包，YAML 的字段名与 JSON 一致
+func EncodeRuleBundle(bundle models.RuleBundle, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if format != BundleYAML {
+		return data, nil
+	}
+
+	// JSON 是合法的 YAML：解析为节点可保留字段顺序，再清除流式风格输出为块格式
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	clearYAMLStyle(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func clearYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearYAMLStyle(child)
+	}
+}
+
+// DecodeRuleBundle 解析规则包，format 为空时按内容判断 JSON 或 YAML
+func DecodeRuleBundle(data []byte, format string) (models.RuleBundle, error) {
+	if format == "" {
+		format = BundleYAML
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			format = BundleJSON
+		}
+	}
+
+	var bundle models.RuleBundle
+	switch format {
+	case BundleJSON:
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			return bundle, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+	case BundleYAML:
+		var value interface{}
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return bundle, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		converted, err := json.Marshal(value)
+		if err != nil {
+			return bundle, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		if err := json.Unmarshal(converted, &bundle); err != nil {
+			return bundle, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+	default:
+		return bundle, fmt.Errorf("%w: 不支持的格式 %s", ErrInvalidBundle, format)
+	}
+
+	switch {
+	case bundle.Version == 0:
+		return bundle, fmt.Errorf("%w: 缺少 version", ErrInvalidBundle)
+	case bundle.Version > RuleBundleVersion:
+		return bundle, fmt.Errorf("%w: 不支持的版本 %d，当前支持 %d", ErrInvalidBundle, bundle.Version, RuleBundleVersion)
+	}
+	return bundle, nil
+}
+
+// ImportRules 导入规则包。规则包中的规则总是分配本机 ID（替换现有规则时沿用其 ID），对应关系返回在 id_map 中；
+// 全部规则校验通过后才在一个事务中写入，dryRun 时只返回预览。
+// replace 模式下要删除的规则仍被引用时，只有 force 为 true 才会删除，并在同一事务中停用、解除这些引用
+func ImportRules(bundle models.RuleBundle, mode, onConflict string, dryRun, force bool) (*models.RuleImportResult, error) {
+	if mode == "" {
+		mode = ImportMerge
+	}
+	if onConflict == "" {
+		onConflict = ImportSkip
+	}
+	if mode != ImportMerge && mode != ImportReplace {
+		return nil, fmt.Errorf("%w: 不支持的导入模式 %s", ErrInvalidBundle, mode)
+	}
+	if onConflict != ImportSkip && onConflict != ImportOverwrite && onConflict != ImportCopy {
+		return nil, fmt.Errorf("%w: 不支持的冲突处理方式 %s", ErrInvalidBundle, onConflict)
+	}
+
+	existing, err := database.GetRules()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Rule, len(existing))
+	byName := make(map[string]models.Rule, len(existing))
+	for _, rule := range existing {
+		byID[rule.ID] = rule
+		if _, ok := byName[rule.Name]; !ok {
+			byName[rule.Name] = rule
+		}
+	}
+
+	result := &models.RuleImportResult{
+		Version:    bundle.Version,
+		Mode:       mode,
+		OnConflict: onConflict,
+		DryRun:     dryRun,
+		Force:      force,
+		Items:      make([]models.RuleImportItem, 0, len(bundle.Rules)),
+		IDMap:      make(map[string]string),
+	}
+	var creates, updates []models.Rule
+	var order []string
+	claimed := make(map[string]bool)
+	bundleIDs := make(map[string]bool)
+	idBase := time.Now().UnixNano()
+
+	for i, rule := range bundle.Rules {
+		item := models.RuleImportItem{Index: i, BundleID: rule.ID, Name: rule.Name}
+		if rule.ID != "" {
+			if bundleIDs[rule.ID] {
+				return nil, fmt.Errorf("%w: rules[%d]: ID %s 重复", ErrInvalidBundle, i, rule.ID)
+			}
+			bundleIDs[rule.ID] = true
+		}
+		if err := mapRulePaths(&rule, localPath); err != nil {
+			return nil, fmt.Errorf("%w: rules[%d]（%s）: %v", ErrInvalidBundle, i, rule.Name, err)
+		}
+		if err := ValidateRule(rule); err != nil {
+			return nil, fmt.Errorf("%w: rules[%d]（%s）: %v", ErrInvalidBundle, i, rule.Name, err)
+		}
+
+		// 同 ID 优先于同名，每条现有规则只与一条导入规则对应
+		var match *models.Rule
+		if found, ok := byID[rule.ID]; ok && rule.ID != "" && !claimed[found.ID] {
+			match, item.Conflict = &found, "id"
+		} else if found, ok := byName[rule.Name]; ok && !claimed[found.ID] {
+			match, item.Conflict = &found, "name"
+		}
+		if match != nil {
+			item.ExistingID = match.ID
+		}
+
+		switch {
+		case match != nil && mode == ImportMerge && onConflict == ImportSkip:
+			claimed[match.ID] = true
+			item.Operation = ImportOpSkip
+			item.RuleID = match.ID
+			item.Message = "已存在，保留现有规则"
+			result.Skipped++
+		case match != nil && (mode == ImportReplace || onConflict == ImportOverwrite):
+			claimed[match.ID] = true
+			rule.ID = match.ID
+			item.Operation = ImportOpUpdate
+			item.RuleID = rule.ID
+			updates = append(updates, rule)
+			result.Updated++
+		default:
+			rule.ID = fmt.Sprintf("rule_%d", idBase+int64(i))
+			item.Operation = ImportOpCreate
+			item.RuleID = rule.ID
+			creates = append(creates, rule)
+			result.Created++
+		}
+
+		if item.BundleID != "" {
+			result.IDMap[item.BundleID] = item.RuleID
+		}
+		order = append(order, item.RuleID)
+		result.Items = append(result.Items, item)
+	}
+
+	var deletes, referenced []string
+	if mode == ImportReplace {
+		references := ruleReferences()
+		for _, rule := range existing {
+			if claimed[rule.ID] {
+				continue
+			}
+			item := models.RuleImportItem{
+				Index:     -1,
+				Name:      rule.Name,
+				Operation: ImportOpDelete,
+				RuleID:    rule.ID,
+			}
+			if refs := references[rule.ID]; len(refs) > 0 {
+				referenced = append(referenced, rule.Name)
+				if force {
+					item.Message = "仍被引用，将停用并解除引用: " + strings.Join(refs, "、")
+				} else {
+					item.Message = "仍被引用，需要 force=true 才会删除: " + strings.Join(refs, "、")
+				}
+			}
+			deletes = append(deletes, rule.ID)
+			result.Items = append(result.Items, item)
+			result.Deleted++
+		}
+	} else {
+		order = nil
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if len(referenced) > 0 && !force {
+		return nil, fmt.Errorf("%w: %s", ErrRuleInUse, strings.Join(referenced, "、"))
+	}
+
+	// 提交前记下引用了被删除规则的监听文件夹，提交后按新配置重启
+	var affectedWatchers []string
+	if folders, err := database.GetWatchFolders(); err == nil {
+		for _, folder := range folders {
+			if folder.RuleID != "" && containsString(deletes, folder.RuleID) {
+				affectedWatchers = append(affectedWatchers, folder.ID)
+			}
+		}
+	}
+	if err := database.ImportRules(creates, updates, deletes, order); err != nil {
+		return nil, err
+	}
+	for _, id := range affectedWatchers {
+		if err := ReloadWatcher(id); err != nil {
+			log.Printf("重新加载监听文件夹 %s 失败: %v", id, err)
+		}
+	}
+	return result, nil
+}
+
+// ruleReferences 列出引用各规则的监听文件夹、定时整理与 webhook
+func ruleReferences() map[string][]string {
+	references := make(map[string][]string)
+	if folders, err := database.GetWatchFolders(); err == nil {
+		for _, folder := range folders {
+			if folder.RuleID != "" {
+				references[folder.RuleID] = append(references[folder.RuleID], "监听文件夹 "+folder.Path)
+			}
+		}
+	}
+	if schedules, err := database.GetSchedules(); err == nil {
+		for _, schedule := range schedules {
+			for _, id := range schedule.RuleIDs {
+				references[id] = append(references[id], "定时整理 "+schedule.Name)
+			}
+		}
+	}
+	if list, err := database.GetWebhooks(); err == nil {
+		for _, webhook := range list {
+			if webhook.RuleID != "" {
+				references[webhook.RuleID] = append(references[webhook.RuleID], "webhook "+webhook.Name)
+			}
+		}
+	}
+	return references
+}
+
+// mapRulePaths 对规则中的路径（目标目录、步骤目标目录、来源目录条件）逐一转换
+func mapRulePaths(rule *models.Rule, convert func(string) (string, error)) error {
+	var err error
+	if rule.Destination, err = convert(rule.Destination); err != nil {
+		return fmt.Errorf("destination: %v", err)
+	}
+	steps := make([]models.RuleStep, len(rule.Steps))
+	copy(steps, rule.Steps)
+	for i := range steps {
+		if steps[i].Destination, err = convert(steps[i].Destination); err != nil {
+			return fmt.Errorf("steps[%d].destination: %v", i, err)
+		}
+	}
+	rule.Steps = steps
+	if rule.Conditions.SourcePrefix, err = convert(rule.Conditions.SourcePrefix); err != nil {
+		return fmt.Errorf("conditions.source_prefix: %v", err)
+	}
+	if rule.ConditionTree != nil {
+		tree := *rule.ConditionTree
+		if err := mapConditionTreePaths("condition_tree", &tree, convert); err != nil {
+			return err
+		}
+		rule.ConditionTree = &tree
+	}
+	return nil
+}
+
+func mapConditionTreePaths(path string, node *models.ConditionNode, convert func(string) (string, error)) error {
+	var err error
+	switch {
+	case node.All != nil:
+		node.All = append([]models.ConditionNode(nil), node.All...)
+		for i := range node.All {
+			if err := mapConditionTreePaths(fmt.Sprintf("%s.all[%d]", path, i), &node.All[i], convert); err != nil {
+				return err
+			}
+		}
+	case node.Any != nil:
+		node.Any = append([]models.ConditionNode(nil), node.Any...)
+		for i := range node.Any {
+			if err := mapConditionTreePaths(fmt.Sprintf("%s.any[%d]", path, i), &node.Any[i], convert); err != nil {
+				return err
+			}
+		}
+	case node.Not != nil:
+		not := *node.Not
+		if err := mapConditionTreePaths(path+".not", &not, convert); err != nil {
+			return err
+		}
+		node.Not = &not
+	case node.Match != nil:
+		match := *node.Match
+		if match.SourcePrefix, err = convert(match.SourcePrefix); err != nil {
+			return fmt.Errorf("%s.match.source_prefix: %v", path, err)
+		}
+		node.Match = &match
+	}
+	return nil
+}
+
+// portablePath 主目录下的绝对路径改写为 ~ 开头
+func portablePath(path string) (string, error) {
+	if path == "" || !filepath.IsAbs(path) {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path, nil
+	}
+	if rel, err := filepath.Rel(homeDir, path); err == nil && filepath.IsLocal(rel) {
+		return "~/" + filepath.ToSlash(rel), nil
+	}
+	if filepath.Clean(path) == filepath.Clean(homeDir) {
+		return "~", nil
+	}
+	return path, nil
+}
+
+// localPath 展开 $VAR、${VAR} 形式的环境变量，变量未定义时报错；~ 保留到使用时再展开
+func localPath(path string) (string, error) {
+	if !strings.Contains(path, "$") {
+		return path, nil
+	}
+	var missing []string
+	expanded := os.Expand(path, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("环境变量未定义: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
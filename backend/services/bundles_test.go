@@ -0,0 +1,228 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"main/database"
+	"main/models"
+)
+
+// seedBundleRules 创建现有规则 A（rule_a）、B（rule_b）与 D（rule_d）
+func seedBundleRules(t *testing.T) {
+	t.Helper()
+	for _, rule := range []models.Rule{
+		{ID: "rule_a", Name: "A", Destination: "/srv/a"},
+		{ID: "rule_b", Name: "B", Destination: "/srv/b"},
+		{ID: "rule_d", Name: "D", Destination: "/srv/d"},
+	} {
+		rule.Action = ActionCopy
+		rule.CustomExtensions = []string{".txt"}
+		rule.Enabled = true
+		if _, err := database.CreateRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testBundle 规则包：C 为新规则，A 与现有规则同 ID，B 只与现有规则同名
+func testBundle() models.RuleBundle {
+	rule := func(id, name, destination string) models.Rule {
+		return models.Rule{
+			ID: id, Name: name, Destination: destination,
+			Action: ActionMove, CustomExtensions: []string{".pdf"}, Enabled: true,
+		}
+	}
+	return models.RuleBundle{
+		Version: RuleBundleVersion,
+		Rules: []models.Rule{
+			rule("bundle_c", "C", "/srv/new-c"),
+			rule("rule_a", "A", "/srv/new-a"),
+			rule("bundle_b", "B", "/srv/new-b"),
+		},
+	}
+}
+
+// ruleDestinations 按优先级排列的规则名称与目标目录
+func ruleDestinations(t *testing.T) [][2]string {
+	t.Helper()
+	rules, err := database.GetRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make([][2]string, len(rules))
+	for i, rule := range rules {
+		result[i] = [2]string{rule.Name, rule.Destination}
+	}
+	return result
+}
+
+func TestImportRulesModes(t *testing.T) {
+	unchanged := [][2]string{{"A", "/srv/a"}, {"B", "/srv/b"}, {"D", "/srv/d"}}
+	cases := []struct {
+		name       string
+		mode       string
+		onConflict string
+		dryRun     bool
+		wantOps    []string // 规则包中各规则的操作，replace 模式下随后是被删除的规则
+		wantRules  [][2]string
+	}{
+		{
+			name:      "merge skips existing rules",
+			mode:      ImportMerge,
+			wantOps:   []string{ImportOpCreate, ImportOpSkip, ImportOpSkip},
+			wantRules: append(unchanged, [2]string{"C", "/srv/new-c"}),
+		},
+		{
+			name:       "merge overwrites by id, then by name",
+			mode:       ImportMerge,
+			onConflict: ImportOverwrite,
+			wantOps:    []string{ImportOpCreate, ImportOpUpdate, ImportOpUpdate},
+			wantRules:  [][2]string{{"A", "/srv/new-a"}, {"B", "/srv/new-b"}, {"D", "/srv/d"}, {"C", "/srv/new-c"}},
+		},
+		{
+			name:       "merge copies conflicting rules",
+			mode:       ImportMerge,
+			onConflict: ImportCopy,
+			wantOps:    []string{ImportOpCreate, ImportOpCreate, ImportOpCreate},
+			wantRules: append(unchanged,
+				[2]string{"C", "/srv/new-c"}, [2]string{"A", "/srv/new-a"}, [2]string{"B", "/srv/new-b"}),
+		},
+		{
+			name:      "replace follows the bundle",
+			mode:      ImportReplace,
+			wantOps:   []string{ImportOpCreate, ImportOpUpdate, ImportOpUpdate, ImportOpDelete},
+			wantRules: [][2]string{{"C", "/srv/new-c"}, {"A", "/srv/new-a"}, {"B", "/srv/new-b"}},
+		},
+		{
+			name:      "dry run changes nothing",
+			mode:      ImportReplace,
+			dryRun:    true,
+			wantOps:   []string{ImportOpCreate, ImportOpUpdate, ImportOpUpdate, ImportOpDelete},
+			wantRules: unchanged,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			initTestDB(t)
+			seedBundleRules(t)
+
+			result, err := ImportRules(testBundle(), tc.mode, tc.onConflict, tc.dryRun, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ops []string
+			for _, item := range result.Items {
+				ops = append(ops, item.Operation)
+			}
+			if !reflect.DeepEqual(ops, tc.wantOps) {
+				t.Fatalf("operations = %v, want %v", ops, tc.wantOps)
+			}
+			if got := ruleDestinations(t); !reflect.DeepEqual(got, tc.wantRules) {
+				t.Fatalf("rules = %v, want %v", got, tc.wantRules)
+			}
+			if result.IDMap["bundle_c"] == "" || result.IDMap["bundle_c"] == "bundle_c" {
+				t.Fatalf("id_map = %v, want a local ID for bundle_c", result.IDMap)
+			}
+		})
+	}
+}
+
+func TestImportRulesRejectsInvalidBundles(t *testing.T) {
+	invalid := testBundle()
+	invalid.Rules[2].ConflictPolicy = "bogus"
+	duplicate := testBundle()
+	duplicate.Rules[2].ID = duplicate.Rules[0].ID
+
+	cases := []struct {
+		name       string
+		bundle     models.RuleBundle
+		mode       string
+		onConflict string
+	}{
+		{name: "unknown mode", bundle: testBundle(), mode: "sync"},
+		{name: "unknown conflict handling", bundle: testBundle(), mode: ImportMerge, onConflict: "rename"},
+		{name: "invalid rule", bundle: invalid, mode: ImportMerge},
+		{name: "duplicate ids", bundle: duplicate, mode: ImportMerge},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			initTestDB(t)
+			seedBundleRules(t)
+			before := ruleDestinations(t)
+
+			if _, err := ImportRules(tc.bundle, tc.mode, tc.onConflict, false, false); !errors.Is(err, ErrInvalidBundle) {
+				t.Fatalf("ImportRules error = %v, want ErrInvalidBundle", err)
+			}
+			if after := ruleDestinations(t); !reflect.DeepEqual(after, before) {
+				t.Fatalf("rules changed by a rejected import: %v", after)
+			}
+		})
+	}
+}
+
+func TestImportRulesReplaceReferencedRules(t *testing.T) {
+	cases := []struct {
+		name  string
+		force bool
+	}{
+		{name: "refused without force"},
+		{name: "detached with force", force: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			home := initTestDB(t)
+			seedBundleRules(t)
+			folder, err := database.CreateWatchFolder(models.WatchFolder{Path: home, RuleID: "rule_d", Enabled: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			webhook, err := database.CreateWebhook(models.Webhook{Name: "hook", URL: "http://localhost/hook", RuleID: "rule_d", Enabled: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			only, err := database.CreateSchedule(models.Schedule{Name: "only d", Path: home, Cron: "0 * * * *", RuleIDs: []string{"rule_d"}, Enabled: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			shared, err := database.CreateSchedule(models.Schedule{Name: "a and d", Path: home, Cron: "0 * * * *", RuleIDs: []string{"rule_a", "rule_d"}, Enabled: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = ImportRules(testBundle(), ImportReplace, "", false, tc.force)
+			if !tc.force {
+				if !errors.Is(err, ErrRuleInUse) {
+					t.Fatalf("ImportRules error = %v, want ErrRuleInUse", err)
+				}
+				if _, err := database.GetRule("rule_d"); err != nil {
+					t.Fatalf("referenced rule deleted without force: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := database.GetRule("rule_d"); err == nil {
+				t.Fatalf("rule_d still exists")
+			}
+			if got, _ := database.GetWatchFolder(folder.ID); got.RuleID != "" || got.Enabled {
+				t.Fatalf("watch folder = %+v, want detached and disabled", got)
+			}
+			if got, _ := database.GetWebhook(webhook.ID); got.RuleID != "" || got.Enabled {
+				t.Fatalf("webhook = %+v, want detached and disabled", got)
+			}
+			if got, _ := database.GetSchedule(only.ID); len(got.RuleIDs) != 0 || got.Enabled {
+				t.Fatalf("schedule = %+v, want no rules and disabled", got)
+			}
+			if got, _ := database.GetSchedule(shared.ID); !reflect.DeepEqual(got.RuleIDs, []string{"rule_a"}) || !got.Enabled {
+				t.Fatalf("schedule = %+v, want rule_a only and still enabled", got)
+			}
+		})
+	}
+}
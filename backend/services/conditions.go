@@ -0,0 +1,370 @@
+package services
+
+import (
+	"container/list"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"main/models"
+)
+
+// FileFacts 规则匹配时使用的文件信息，每个文件只采集一次
+type FileFacts struct {
+	Path    string
+	Name    string
+	Dir     string
+	Ext     string // 小写，不含点
+	Type    string // detectFileType 的分类
+	MIME    string // 按文件头识别的 MIME 类型，无法识别时为空
+	IsDir   bool
+	Hidden  bool
+	ModTime time.Time
+	Now     time.Time
+
+	size      int64
+	sizeKnown bool
+}
+
+// CollectFileFacts 读取文件信息，文件夹的大小在首次用到时再统计
+func CollectFileFacts(filePath string) (*FileFacts, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(filePath)
+	fileType, mime := detectFileKind(filePath, info)
+	facts := &FileFacts{
+		Path:    filePath,
+		Name:    name,
+		Dir:     filepath.Dir(filePath),
+		Ext:     strings.TrimPrefix(strings.ToLower(filepath.Ext(filePath)), "."),
+		Type:    fileType,
+		MIME:    mime,
+		IsDir:   info.IsDir(),
+		Hidden:  strings.HasPrefix(name, "."),
+		ModTime: info.ModTime(),
+		Now:     time.Now(),
+	}
+	if !info.IsDir() {
+		facts.size = info.Size()
+		facts.sizeKnown = true
+	}
+	return facts, nil
+}
+
+// Size 文件大小；文件夹为其中所有普通文件的总大小
+func (f *FileFacts) Size() int64 {
+	if !f.sizeKnown {
+		var total int64
+		filepath.WalkDir(f.Path, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.Type().IsRegular() {
+				return nil
+			}
+			if info, err := entry.Info(); err == nil {
+				total += info.Size()
+			}
+			return nil
+		})
+		f.size = total
+		f.sizeKnown = true
+	}
+	return f.size
+}
+
+// AgeHours 距最后修改的小时数
+func (f *FileFacts) AgeHours() float64 {
+	return f.Now.Sub(f.ModTime).Hours()
+}
+
+// maxConditionDepth 条件树的最大嵌套层数
+const maxConditionDepth = 16
+
+// ValidateConditions 校验附加匹配条件，错误信息带有出错字段的路径
+func ValidateConditions(conditions models.RuleConditions) error {
+	return validateConditionsAt("conditions", conditions)
+}
+
+func validateConditionsAt(path string, conditions models.RuleConditions) error {
+	fail := func(field, format string, args ...interface{}) error {
+		return fmt.Errorf("%s.%s: %s", path, field, fmt.Sprintf(format, args...))
+	}
+
+	if conditions.NameGlob != "" {
+		if _, err := filepath.Match(strings.ToLower(conditions.NameGlob), ""); err != nil {
+			return fail("name_glob", "文件名 glob 无效: %s", conditions.NameGlob)
+		}
+	}
+	if conditions.NameRegex != "" {
+		if _, err := regexp.Compile(conditions.NameRegex); err != nil {
+			return fail("name_regex", "文件名正则表达式无效: %v", err)
+		}
+	}
+	if conditions.MinSize < 0 {
+		return fail("min_size", "文件大小不能为负数")
+	}
+	if conditions.MaxSize < 0 {
+		return fail("max_size", "文件大小不能为负数")
+	}
+	if conditions.MaxSize > 0 && conditions.MinSize > conditions.MaxSize {
+		return fail("min_size", "不能大于 max_size")
+	}
+	if conditions.MinAgeHours < 0 {
+		return fail("min_age_hours", "不能为负数")
+	}
+	if conditions.MaxAgeHours < 0 {
+		return fail("max_age_hours", "不能为负数")
+	}
+	if conditions.MaxAgeHours > 0 && conditions.MinAgeHours > conditions.MaxAgeHours {
+		return fail("min_age_hours", "不能大于 max_age_hours")
+	}
+	if conditions.SourcePrefix != "" && !filepath.IsAbs(expandHome(conditions.SourcePrefix)) {
+		return fail("source_prefix", "必须是绝对路径或以 ~ 开头")
+	}
+	return nil
+}
+
+// ValidateConditionTree 校验条件树：每个节点恰好设置 all、any、not、match 之一，
+// 分组不能为空，叶子条件不能为空。错误信息带有节点路径，如 condition_tree.any[1].not.match.name_regex
+func ValidateConditionTree(node *models.ConditionNode) error {
+	if node == nil {
+		return nil
+	}
+	return validateConditionNode("condition_tree", *node, 1)
+}
+
+func validateConditionNode(path string, node models.ConditionNode, depth int) error {
+	if depth > maxConditionDepth {
+		return fmt.Errorf("%s: 嵌套超过 %d 层", path, maxConditionDepth)
+	}
+
+	set := 0
+	if node.All != nil {
+		set++
+	}
+	if node.Any != nil {
+		set++
+	}
+	if node.Not != nil {
+		set++
+	}
+	if node.Match != nil {
+		set++
+	}
+	if set != 1 {
+		return fmt.Errorf("%s: 必须且只能设置 all、any、not、match 中的一个", path)
+	}
+
+	switch {
+	case node.All != nil:
+		return validateConditionGroup(path+".all", node.All, depth)
+	case node.Any != nil:
+		return validateConditionGroup(path+".any", node.Any, depth)
+	case node.Not != nil:
+		return validateConditionNode(path+".not", *node.Not, depth+1)
+	default:
+		if !hasConditions(*node.Match) {
+			return fmt.Errorf("%s.match: 至少需要一个条件", path)
+		}
+		return validateConditionsAt(path+".match", *node.Match)
+	}
+}
+
+func validateConditionGroup(path string, children []models.ConditionNode, depth int) error {
+	if len(children) == 0 {
+		return fmt.Errorf("%s: 不能为空", path)
+	}
+	for i, child := range children {
+		if err := validateConditionNode(fmt.Sprintf("%s[%d]", path, i), child, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasConditions 是否设置了任何附加条件
+func hasConditions(conditions models.RuleConditions) bool {
+	return conditions.NameGlob != "" || conditions.NameRegex != "" ||
+		conditions.MinSize != 0 || conditions.MaxSize != 0 ||
+		conditions.MinAgeHours != 0 || conditions.MaxAgeHours != 0 ||
+		conditions.SourcePrefix != "" || conditions.Hidden != nil ||
+		len(conditions.Extensions) > 0 || len(conditions.FileTypes) > 0 || len(conditions.MIMETypes) > 0
+}
+
+// conditionCheck 单项条件：field 为条件字段名，eval 返回是否满足及实际取值说明
+type conditionCheck struct {
+	field string
+	eval  func(facts *FileFacts) (bool, string)
+}
+
+// conditionChecks 列出已设置的各项条件，MatchConditions 与规则测试共用
+func conditionChecks(conditions models.RuleConditions) []conditionCheck {
+	var checks []conditionCheck
+	add := func(field string, eval func(facts *FileFacts) (bool, string)) {
+		checks = append(checks, conditionCheck{field: field, eval: eval})
+	}
+
+	if len(conditions.Extensions) > 0 {
+		add("extensions", func(f *FileFacts) (bool, string) {
+			return f.Ext != "" && matchExtension(f.Ext, conditions.Extensions),
+				fmt.Sprintf("扩展名 %q，要求 %v", f.Ext, conditions.Extensions)
+		})
+	}
+	if len(conditions.FileTypes) > 0 {
+		add("file_types", func(f *FileFacts) (bool, string) {
+			return f.Type != "" && containsString(conditions.FileTypes, f.Type),
+				fmt.Sprintf("类型 %q，要求 %v", f.Type, conditions.FileTypes)
+		})
+	}
+	if len(conditions.MIMETypes) > 0 {
+		add("mime_types", func(f *FileFacts) (bool, string) {
+			return matchMIMEType(f.MIME, conditions.MIMETypes),
+				fmt.Sprintf("MIME %q，要求 %v", f.MIME, conditions.MIMETypes)
+		})
+	}
+	if conditions.NameGlob != "" {
+		add("name_glob", func(f *FileFacts) (bool, string) {
+			matched, err := filepath.Match(strings.ToLower(conditions.NameGlob), strings.ToLower(f.Name))
+			return err == nil && matched, fmt.Sprintf("文件名 %q，glob %q", f.Name, conditions.NameGlob)
+		})
+	}
+	if conditions.NameRegex != "" {
+		re, err := compileNameRegex(conditions.NameRegex)
+		add("name_regex", func(f *FileFacts) (bool, string) {
+			return err == nil && re.MatchString(f.Name), fmt.Sprintf("文件名 %q，正则 %q", f.Name, conditions.NameRegex)
+		})
+	}
+	if conditions.MinSize > 0 {
+		add("min_size", func(f *FileFacts) (bool, string) {
+			return f.Size() >= conditions.MinSize, fmt.Sprintf("大小 %d，至少 %d", f.Size(), conditions.MinSize)
+		})
+	}
+	if conditions.MaxSize > 0 {
+		add("max_size", func(f *FileFacts) (bool, string) {
+			return f.Size() <= conditions.MaxSize, fmt.Sprintf("大小 %d，至多 %d", f.Size(), conditions.MaxSize)
+		})
+	}
+	if conditions.MinAgeHours > 0 {
+		add("min_age_hours", func(f *FileFacts) (bool, string) {
+			return f.AgeHours() >= conditions.MinAgeHours,
+				fmt.Sprintf("修改于 %.1f 小时前，至少 %g", f.AgeHours(), conditions.MinAgeHours)
+		})
+	}
+	if conditions.MaxAgeHours > 0 {
+		add("max_age_hours", func(f *FileFacts) (bool, string) {
+			return f.AgeHours() <= conditions.MaxAgeHours,
+				fmt.Sprintf("修改于 %.1f 小时前，至多 %g", f.AgeHours(), conditions.MaxAgeHours)
+		})
+	}
+	if conditions.SourcePrefix != "" {
+		add("source_prefix", func(f *FileFacts) (bool, string) {
+			return isWithinDir(f.Dir, expandHome(conditions.SourcePrefix)),
+				fmt.Sprintf("所在目录 %q，要求位于 %q", f.Dir, conditions.SourcePrefix)
+		})
+	}
+	if conditions.Hidden != nil {
+		add("hidden", func(f *FileFacts) (bool, string) {
+			return f.Hidden == *conditions.Hidden, fmt.Sprintf("隐藏文件: %v，要求 %v", f.Hidden, *conditions.Hidden)
+		})
+	}
+	return checks
+}
+
+// nameRegexCacheSize 最多缓存的文件名正则表达式数量
+const nameRegexCacheSize = 256
+
+// nameRegexCache 最近使用的文件名正则表达式，键为表达式本身，超出容量时淘汰最久未使用的。
+// conditionChecks 对每个文件都会调用，缓存避免每个文件、每条规则重复编译；规则修改或删除后旧的表达式会被逐渐淘汰
+var nameRegexCache = struct {
+	mu    sync.Mutex
+	order *list.List // 元素为 *regexp.Regexp，最近使用的在前
+	items map[string]*list.Element
+}{
+	order: list.New(),
+	items: make(map[string]*list.Element),
+}
+
+// compileNameRegex 编译文件名正则表达式，结果按表达式缓存
+func compileNameRegex(pattern string) (*regexp.Regexp, error) {
+	cache := &nameRegexCache
+	cache.mu.Lock()
+	if elem, ok := cache.items[pattern]; ok {
+		cache.order.MoveToFront(elem)
+		cache.mu.Unlock()
+		return elem.Value.(*regexp.Regexp), nil
+	}
+	cache.mu.Unlock()
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if elem, ok := cache.items[pattern]; ok {
+		cache.order.MoveToFront(elem)
+		return elem.Value.(*regexp.Regexp), nil
+	}
+	cache.items[pattern] = cache.order.PushFront(re)
+	for cache.order.Len() > nameRegexCacheSize {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.items, oldest.Value.(*regexp.Regexp).String())
+	}
+	return re, nil
+}
+
+// MatchConditions 判断文件是否满足全部附加条件
+func MatchConditions(conditions models.RuleConditions, facts *FileFacts) bool {
+	for _, check := range conditionChecks(conditions) {
+		if passed, _ := check.eval(facts); !passed {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchConditionTree 对文件求值条件树，nil 视为满足
+func MatchConditionTree(node *models.ConditionNode, facts *FileFacts) bool {
+	if node == nil {
+		return true
+	}
+	switch {
+	case node.All != nil:
+		for i := range node.All {
+			if !MatchConditionTree(&node.All[i], facts) {
+				return false
+			}
+		}
+		return true
+	case node.Any != nil:
+		for i := range node.Any {
+			if MatchConditionTree(&node.Any[i], facts) {
+				return true
+			}
+		}
+		return false
+	case node.Not != nil:
+		return !MatchConditionTree(node.Not, facts)
+	case node.Match != nil:
+		return MatchConditions(*node.Match, facts)
+	default:
+		return false
+	}
+}
+
+// isWithinDir 判断 path 是否为 dir 或其子目录
+func isWithinDir(path, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel == "." || filepath.IsLocal(rel)
+}
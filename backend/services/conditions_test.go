@@ -0,0 +1,211 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"main/models"
+)
+
+// testFacts 名为 Invoice-2024.pdf、大小 1000 字节、两小时前修改的文件
+func testFacts() *FileFacts {
+	now := time.Now()
+	return &FileFacts{
+		Path:      "/data/in/Invoice-2024.pdf",
+		Name:      "Invoice-2024.pdf",
+		Dir:       "/data/in",
+		Ext:       "pdf",
+		Type:      "document",
+		MIME:      "application/pdf",
+		ModTime:   now.Add(-2 * time.Hour),
+		Now:       now,
+		size:      1000,
+		sizeKnown: true,
+	}
+}
+
+func TestValidateConditions(t *testing.T) {
+	cases := []struct {
+		name       string
+		conditions models.RuleConditions
+		wantField  string // 为空时期望校验通过
+	}{
+		{name: "empty", conditions: models.RuleConditions{}},
+		{name: "valid", conditions: models.RuleConditions{
+			NameGlob: "*invoice*", NameRegex: `^\d+`, MinSize: 1, MaxSize: 10,
+			MinAgeHours: 1, MaxAgeHours: 2, SourcePrefix: "~/Downloads",
+		}},
+		{name: "min size only", conditions: models.RuleConditions{MinSize: 100}},
+		{name: "bad glob", conditions: models.RuleConditions{NameGlob: "[a"}, wantField: "conditions.name_glob"},
+		{name: "bad regex", conditions: models.RuleConditions{NameRegex: "(a"}, wantField: "conditions.name_regex"},
+		{name: "negative size", conditions: models.RuleConditions{MinSize: -1}, wantField: "conditions.min_size"},
+		{name: "min above max size", conditions: models.RuleConditions{MinSize: 10, MaxSize: 5}, wantField: "conditions.min_size"},
+		{name: "negative age", conditions: models.RuleConditions{MaxAgeHours: -1}, wantField: "conditions.max_age_hours"},
+		{name: "min above max age", conditions: models.RuleConditions{MinAgeHours: 3, MaxAgeHours: 2}, wantField: "conditions.min_age_hours"},
+		{name: "relative source", conditions: models.RuleConditions{SourcePrefix: "Downloads"}, wantField: "conditions.source_prefix"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateConditions(tc.conditions)
+			if tc.wantField == "" {
+				if err != nil {
+					t.Fatalf("ValidateConditions error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tc.wantField+":") {
+				t.Fatalf("ValidateConditions error = %v, want %s", err, tc.wantField)
+			}
+		})
+	}
+}
+
+func TestMatchConditions(t *testing.T) {
+	hidden, visible := true, false
+	cases := []struct {
+		name       string
+		conditions models.RuleConditions
+		want       bool
+	}{
+		{name: "no conditions", conditions: models.RuleConditions{}, want: true},
+		{name: "glob ignores case", conditions: models.RuleConditions{NameGlob: "*INVOICE*"}, want: true},
+		{name: "glob mismatch", conditions: models.RuleConditions{NameGlob: "*receipt*"}},
+		{name: "regex", conditions: models.RuleConditions{NameRegex: `-\d{4}\.pdf$`}, want: true},
+		{name: "regex mismatch", conditions: models.RuleConditions{NameRegex: `^\d`}},
+		{name: "size within range", conditions: models.RuleConditions{MinSize: 1000, MaxSize: 1000}, want: true},
+		{name: "too small", conditions: models.RuleConditions{MinSize: 1001}},
+		{name: "too large", conditions: models.RuleConditions{MaxSize: 999}},
+		{name: "old enough", conditions: models.RuleConditions{MinAgeHours: 1}, want: true},
+		{name: "too new", conditions: models.RuleConditions{MinAgeHours: 3}},
+		{name: "too old", conditions: models.RuleConditions{MaxAgeHours: 1}},
+		{name: "source prefix", conditions: models.RuleConditions{SourcePrefix: "/data"}, want: true},
+		{name: "source prefix is not a string prefix", conditions: models.RuleConditions{SourcePrefix: "/data/i"}},
+		{name: "not hidden", conditions: models.RuleConditions{Hidden: &visible}, want: true},
+		{name: "hidden only", conditions: models.RuleConditions{Hidden: &hidden}},
+		{name: "all must pass", conditions: models.RuleConditions{NameGlob: "*invoice*", MinSize: 5000}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := MatchConditions(tc.conditions, testFacts()); got != tc.want {
+				t.Fatalf("MatchConditions = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompileNameRegexEvictsLeastRecentlyUsed(t *testing.T) {
+	first, err := compileNameRegex("^first$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < nameRegexCacheSize+10; i++ {
+		if _, err := compileNameRegex(fmt.Sprintf("^pattern-%d$", i)); err != nil {
+			t.Fatal(err)
+		}
+		// 持续使用的表达式不会被淘汰
+		if again, _ := compileNameRegex("^first$"); again != first {
+			t.Fatalf("recently used pattern was recompiled")
+		}
+	}
+
+	nameRegexCache.mu.Lock()
+	size, indexed := nameRegexCache.order.Len(), len(nameRegexCache.items)
+	kept := nameRegexCache.items["^pattern-0$"] != nil
+	nameRegexCache.mu.Unlock()
+	if size > nameRegexCacheSize || indexed != size {
+		t.Fatalf("cache holds %d entries, limit %d", size, nameRegexCacheSize)
+	}
+	if kept {
+		t.Fatalf("least recently used pattern was not evicted")
+	}
+
+	if _, err := compileNameRegex("(bad"); err == nil {
+		t.Fatalf("invalid pattern compiled")
+	}
+}
+
+func TestValidateConditionTree(t *testing.T) {
+	match := func(conditions models.RuleConditions) models.ConditionNode {
+		return models.ConditionNode{Match: &conditions}
+	}
+	valid := match(models.RuleConditions{NameGlob: "*.pdf"})
+	nested := valid
+	for i := 0; i < maxConditionDepth; i++ {
+		inner := nested
+		nested = models.ConditionNode{Not: &inner}
+	}
+
+	cases := []struct {
+		name    string
+		node    *models.ConditionNode
+		wantErr string // 错误信息前缀，为空时期望校验通过
+	}{
+		{name: "nil", node: nil},
+		{name: "leaf", node: &valid},
+		{name: "groups", node: &models.ConditionNode{Any: []models.ConditionNode{
+			valid,
+			{All: []models.ConditionNode{valid, {Not: &valid}}},
+		}}},
+		{name: "no operator", node: &models.ConditionNode{}, wantErr: "condition_tree:"},
+		{name: "two operators", node: &models.ConditionNode{All: []models.ConditionNode{valid}, Not: &valid}, wantErr: "condition_tree:"},
+		{name: "empty group", node: &models.ConditionNode{All: []models.ConditionNode{}}, wantErr: "condition_tree.all:"},
+		{name: "empty leaf", node: &models.ConditionNode{Any: []models.ConditionNode{valid, match(models.RuleConditions{})}},
+			wantErr: "condition_tree.any[1].match:"},
+		{name: "invalid leaf field", node: &models.ConditionNode{All: []models.ConditionNode{valid, {Not: &models.ConditionNode{
+			Match: &models.RuleConditions{NameRegex: "(a"},
+		}}}}, wantErr: "condition_tree.all[1].not.match.name_regex:"},
+		{name: "too deep", node: &nested, wantErr: "condition_tree.not"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateConditionTree(tc.node)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateConditionTree error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				t.Fatalf("ValidateConditionTree error = %v, want prefix %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchConditionTree(t *testing.T) {
+	pdf := models.ConditionNode{Match: &models.RuleConditions{NameGlob: "*.pdf"}}
+	large := models.ConditionNode{Match: &models.RuleConditions{MinSize: 5000}}
+	invoice := models.ConditionNode{Match: &models.RuleConditions{NameRegex: "(?i)invoice"}}
+
+	cases := []struct {
+		name string
+		node *models.ConditionNode
+		want bool
+	}{
+		{name: "nil", node: nil, want: true},
+		{name: "leaf", node: &pdf, want: true},
+		{name: "all", node: &models.ConditionNode{All: []models.ConditionNode{pdf, invoice}}, want: true},
+		{name: "all with a failing child", node: &models.ConditionNode{All: []models.ConditionNode{pdf, large}}},
+		{name: "any", node: &models.ConditionNode{Any: []models.ConditionNode{large, invoice}}, want: true},
+		{name: "any without a passing child", node: &models.ConditionNode{Any: []models.ConditionNode{large, {Not: &pdf}}}},
+		{name: "not", node: &models.ConditionNode{Not: &large}, want: true},
+		{name: "nested", node: &models.ConditionNode{All: []models.ConditionNode{
+			pdf,
+			{Any: []models.ConditionNode{large, {Not: &models.ConditionNode{Not: &invoice}}}},
+		}}, want: true},
+		{name: "empty node", node: &models.ConditionNode{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := MatchConditionTree(tc.node, testFacts()); got != tc.want {
+				t.Fatalf("MatchConditionTree = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 目标冲突处理策略
+const (
+	ConflictRename     = "rename"      // 追加序号后缀
+	ConflictSkip       = "skip"        // 跳过处理
+	ConflictOverwrite  = "overwrite"   // 覆盖已有文件
+	ConflictKeepNewest = "keep_newest" // 保留较新的文件
+	ConflictDedupe     = "dedupe"      // 内容相同则丢弃
+)
+
+// 冲突处理结果
+const (
+	ResolutionNone        = "none"
+	ResolutionRenamed     = "renamed"
+	ResolutionSkipped     = "skipped"
+	ResolutionOverwritten = "overwritten"
+	ResolutionKeptNewer   = "kept_existing"
+	ResolutionDuplicate   = "duplicate"
+	ResolutionUnchanged   = "unchanged" // 目标就是源文件本身（如原地重命名时名称未变化）
+)
+
+// ConflictResult 冲突处理结果
+type ConflictResult struct {
+	Path       string // 最终目标路径
+	Resolution string // 冲突处理结果
+	Proceed    bool   // 是否需要继续写入目标
+}
+
+// IsValidConflictPolicy 判断冲突策略是否合法（空值表示默认策略）
+func IsValidConflictPolicy(policy string) bool {
+	switch policy {
+	case "", ConflictRename, ConflictSkip, ConflictOverwrite, ConflictKeepNewest, ConflictDedupe:
+		return true
+	default:
+		return false
+	}
+}
+
+// ResolveConflict 根据策略处理目标路径冲突。目标与源是同一个文件时（同一路径，或经由符号链接、
+// 硬链接指向同一文件）不做任何处理，避免 dedupe 等策略把唯一的副本当作重复文件删除
+func ResolveConflict(src, dst, policy string) (ConflictResult, error) {
+	existing, err := os.Stat(dst)
+	if os.IsNotExist(err) {
+		return ConflictResult{Path: dst, Resolution: ResolutionNone, Proceed: true}, nil
+	}
+	if err != nil {
+		return ConflictResult{}, err
+	}
+	if isSameFile(src, dst, existing) {
+		return ConflictResult{Path: dst, Resolution: ResolutionUnchanged}, nil
+	}
+
+	switch policy {
+	case ConflictSkip:
+		return ConflictResult{Path: dst, Resolution: ResolutionSkipped}, nil
+	case ConflictOverwrite:
+		return ConflictResult{Path: dst, Resolution: ResolutionOverwritten, Proceed: true}, nil
+	case ConflictKeepNewest:
+		source, err := os.Stat(src)
+		if err != nil {
+			return ConflictResult{}, err
+		}
+		if source.ModTime().After(existing.ModTime()) {
+			return ConflictResult{Path: dst, Resolution: ResolutionOverwritten, Proceed: true}, nil
+		}
+		return ConflictResult{Path: dst, Resolution: ResolutionKeptNewer}, nil
+	case ConflictDedupe:
+		same, err := sameContent(src, dst)
+		if err != nil {
+			return ConflictResult{}, err
+		}
+		if same {
+			return ConflictResult{Path: dst, Resolution: ResolutionDuplicate}, nil
+		}
+		return renameOnConflict(dst)
+	default:
+		return renameOnConflict(dst)
+	}
+}
+
+// isSameFile 判断 dst（已存在，信息为 existing）与 src 是否为同一个文件
+func isSameFile(src, dst string, existing os.FileInfo) bool {
+	if filepath.Clean(src) == filepath.Clean(dst) {
+		return true
+	}
+	source, err := os.Stat(src)
+	return err == nil && os.SameFile(source, existing)
+}
+
+// renameOnConflict 追加 _1、_2 等序号，直到找到未被占用的路径
+func renameOnConflict(dst string) (ConflictResult, error) {
+	dir := filepath.Dir(dst)
+	ext := filepath.Ext(dst)
+	base := strings.TrimSuffix(filepath.Base(dst), ext)
+
+	for i := 1; i < 10000; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s_%d%s", base, i, ext))
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return ConflictResult{Path: candidate, Resolution: ResolutionRenamed, Proceed: true}, nil
+		}
+	}
+
+	return ConflictResult{}, fmt.Errorf("无法为 %s 生成不冲突的文件名", dst)
+}
+
+// sameContent 比较两个文件（或目录）的 SHA-256 是否一致
+func sameContent(a, b string) (bool, error) {
+	infoA, err := os.Lstat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Lstat(b)
+	if err != nil {
+		return false, err
+	}
+	if infoA.IsDir() != infoB.IsDir() {
+		return false, nil
+	}
+
+	sizeA, err := PathSize(a)
+	if err != nil {
+		return false, err
+	}
+	sizeB, err := PathSize(b)
+	if err != nil {
+		return false, err
+	}
+	if sizeA != sizeB {
+		return false, nil
+	}
+
+	hashA, err := HashPath(a)
+	if err != nil {
+		return false, err
+	}
+	hashB, err := HashPath(b)
+	if err != nil {
+		return false, err
+	}
+	return hashA == hashB, nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveConflict(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	cases := []struct {
+		name           string
+		policy         string
+		setup          func(t *testing.T, src, dst string) // src 内容为 "src"，在此创建 dst
+		wantName       string                              // 期望的目标文件名
+		wantResolution string
+		wantProceed    bool
+	}{
+		{
+			name:           "no conflict",
+			policy:         ConflictSkip,
+			setup:          func(t *testing.T, src, dst string) {},
+			wantName:       "b.txt",
+			wantResolution: ResolutionNone,
+			wantProceed:    true,
+		},
+		{
+			name:   "rename picks the next free suffix",
+			policy: ConflictRename,
+			setup: func(t *testing.T, src, dst string) {
+				writeTestFile(t, dst, "dst")
+				writeTestFile(t, filepath.Join(filepath.Dir(dst), "b_1.txt"), "taken")
+			},
+			wantName:       "b_2.txt",
+			wantResolution: ResolutionRenamed,
+			wantProceed:    true,
+		},
+		{
+			name:           "default policy renames",
+			policy:         "",
+			setup:          func(t *testing.T, src, dst string) { writeTestFile(t, dst, "dst") },
+			wantName:       "b_1.txt",
+			wantResolution: ResolutionRenamed,
+			wantProceed:    true,
+		},
+		{
+			name:           "skip",
+			policy:         ConflictSkip,
+			setup:          func(t *testing.T, src, dst string) { writeTestFile(t, dst, "dst") },
+			wantName:       "b.txt",
+			wantResolution: ResolutionSkipped,
+		},
+		{
+			name:           "overwrite",
+			policy:         ConflictOverwrite,
+			setup:          func(t *testing.T, src, dst string) { writeTestFile(t, dst, "dst") },
+			wantName:       "b.txt",
+			wantResolution: ResolutionOverwritten,
+			wantProceed:    true,
+		},
+		{
+			name:   "keep_newest replaces an older target",
+			policy: ConflictKeepNewest,
+			setup: func(t *testing.T, src, dst string) {
+				writeTestFile(t, dst, "dst")
+				setTestModTime(t, dst, old)
+			},
+			wantName:       "b.txt",
+			wantResolution: ResolutionOverwritten,
+			wantProceed:    true,
+		},
+		{
+			name:   "keep_newest keeps a newer target",
+			policy: ConflictKeepNewest,
+			setup: func(t *testing.T, src, dst string) {
+				writeTestFile(t, dst, "dst")
+				setTestModTime(t, src, old)
+			},
+			wantName:       "b.txt",
+			wantResolution: ResolutionKeptNewer,
+		},
+		{
+			name:           "dedupe drops identical content",
+			policy:         ConflictDedupe,
+			setup:          func(t *testing.T, src, dst string) { writeTestFile(t, dst, "src") },
+			wantName:       "b.txt",
+			wantResolution: ResolutionDuplicate,
+		},
+		{
+			name:           "dedupe renames different content",
+			policy:         ConflictDedupe,
+			setup:          func(t *testing.T, src, dst string) { writeTestFile(t, dst, "dst") },
+			wantName:       "b_1.txt",
+			wantResolution: ResolutionRenamed,
+			wantProceed:    true,
+		},
+		{
+			name:   "dedupe leaves a hard link to the source alone",
+			policy: ConflictDedupe,
+			setup: func(t *testing.T, src, dst string) {
+				if err := os.Link(src, dst); err != nil {
+					t.Skip("hard links not supported:", err)
+				}
+			},
+			wantName:       "b.txt",
+			wantResolution: ResolutionUnchanged,
+		},
+		{
+			name:   "overwrite leaves a symlink to the source alone",
+			policy: ConflictOverwrite,
+			setup: func(t *testing.T, src, dst string) {
+				if err := os.Symlink(src, dst); err != nil {
+					t.Skip("symlinks not supported:", err)
+				}
+			},
+			wantName:       "b.txt",
+			wantResolution: ResolutionUnchanged,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			base := t.TempDir()
+			src := filepath.Join(base, "src", "a.txt")
+			dst := filepath.Join(base, "dst", "b.txt")
+			writeTestFile(t, src, "src")
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				t.Fatal(err)
+			}
+			tc.setup(t, src, dst)
+
+			result, err := ResolveConflict(src, dst, tc.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := filepath.Join(filepath.Dir(dst), tc.wantName)
+			if result.Path != want || result.Resolution != tc.wantResolution || result.Proceed != tc.wantProceed {
+				t.Fatalf("ResolveConflict = %+v, want {Path:%s Resolution:%s Proceed:%v}",
+					result, want, tc.wantResolution, tc.wantProceed)
+			}
+		})
+	}
+}
+
+func TestResolveConflictSamePath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	writeTestFile(t, path, "src")
+
+	for _, policy := range []string{ConflictRename, ConflictOverwrite, ConflictDedupe} {
+		result, err := ResolveConflict(path, path, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Resolution != ResolutionUnchanged || result.Proceed {
+			t.Fatalf("%s: ResolveConflict = %+v, want unchanged", policy, result)
+		}
+	}
+}
+
+// writeTestFile 创建文件及其所在目录
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setTestModTime(t *testing.T, path string, modTime time.Time) {
+	t.Helper()
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
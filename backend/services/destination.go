@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolveDestination 展开目标目录中的 ~ 和 {YYYY}、{ai_category} 等占位符。
+// 占位符只能出现在固定的基础目录之后，展开结果不允许跳出基础目录
+func ResolveDestination(destination string, values TemplateValues) (string, error) {
+	base, rest := splitDestination(expandHome(destination))
+	if strings.Contains(base, "}") {
+		return "", fmt.Errorf("目标目录模板括号不匹配: %s", destination)
+	}
+	if rest == "" {
+		return base, nil
+	}
+
+	segments := strings.Split(filepath.ToSlash(rest), "/")
+	resolved := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		value, err := expandDestinationSegment(segment, values)
+		if err != nil {
+			return "", err
+		}
+		// 占位符取值可能为空或是 "."、".."，不能作为目录名
+		value = strings.TrimSpace(value)
+		if value == "" || value == "." || value == ".." {
+			value = "_"
+		}
+		resolved = append(resolved, value)
+	}
+
+	result := filepath.Join(append([]string{base}, resolved...)...)
+	if rel, err := filepath.Rel(filepath.Clean(base), result); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("目标目录 %s 超出了基础目录 %s", result, base)
+	}
+	return result, nil
+}
+
+// DestinationBase 返回目标目录模板中第一个占位符之前的固定目录
+func DestinationBase(destination string) string {
+	base, _ := splitDestination(expandHome(destination))
+	return base
+}
+
+// splitDestination 将目标目录拆分为固定部分和包含占位符的部分
+func splitDestination(destination string) (base string, rest string) {
+	index := strings.Index(destination, "{")
+	if index < 0 {
+		return destination, ""
+	}
+	cut := strings.LastIndexAny(destination[:index], `/\`)
+	if cut < 0 {
+		return "", destination
+	}
+	if cut == 0 {
+		return destination[:1], destination[1:]
+	}
+	return destination[:cut], destination[cut+1:]
+}
+
+// expandDestinationSegment 展开单级目录中的占位符，占位符取值中的路径分隔符会被替换
+func expandDestinationSegment(segment string, values TemplateValues) (string, error) {
+	var builder strings.Builder
+	for {
+		start := strings.Index(segment, "{")
+		if start < 0 {
+			if strings.Contains(segment, "}") {
+				return "", fmt.Errorf("目标目录模板括号不匹配: %s", segment)
+			}
+			builder.WriteString(segment)
+			return builder.String(), nil
+		}
+		end := strings.Index(segment[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("目标目录模板括号不匹配: %s", segment)
+		}
+		if strings.Contains(segment[:start], "}") {
+			return "", fmt.Errorf("目标目录模板括号不匹配: %s", segment)
+		}
+
+		token := segment[start+1 : start+end]
+		value, ok := templateTokenValue(token, values)
+		if !ok {
+			return "", fmt.Errorf("不支持的目标目录占位符: {%s}", token)
+		}
+		builder.WriteString(segment[:start])
+		builder.WriteString(value)
+		segment = segment[start+end+1:]
+	}
+}
+
+// expandHome 将以 ~ 开头的路径展开为用户主目录
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+}
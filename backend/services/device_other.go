@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package services
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// sameDevice 以卷名近似判断两个路径是否位于同一设备
+func sameDevice(a, b string) bool {
+	return strings.EqualFold(filepath.VolumeName(a), filepath.VolumeName(b))
+}
@@ -0,0 +1,54 @@
+//go:build linux || darwin
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// sameDevice 判断两个路径是否位于同一设备
+func sameDevice(a, b string) bool {
+	devA, errA := deviceOf(a)
+	devB, errB := deviceOf(b)
+	return errA == nil && errB == nil && devA == devB
+}
+
+// deviceOf 返回路径所在设备号（不跟随符号链接）
+func deviceOf(path string) (uint64, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("无法获取 %s 的设备信息", path)
+	}
+	return uint64(stat.Dev), nil
+}
+
+// mountPoint 向上查找路径所在文件系统的挂载点
+func mountPoint(path string) (string, error) {
+	dev, err := deviceOf(path)
+	if err != nil {
+		return "", err
+	}
+
+	current := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(current)
+		if parent == current {
+			return current, nil
+		}
+		parentDev, err := deviceOf(parent)
+		if err != nil {
+			return "", err
+		}
+		if parentDev != dev {
+			return current, nil
+		}
+		current = parent
+	}
+}
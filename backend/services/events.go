@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"main/models"
+)
+
+// 事件类型
+const (
+	EventStage     = "stage"     // 处理阶段变化
+	EventProgress  = "progress"  // 复制进度
+	EventCompleted = "completed" // 单个文件处理完成
+	EventFailed    = "failed"    // 单个文件处理失败
+	EventJob       = "job"       // 任务状态变化
+)
+
+// 处理阶段
+const (
+	StageMatching    = "matching_rule"
+	StageAnalyzing   = "analyzing"
+	StageConverting  = "converting_pdf"
+	StageWaitModel   = "waiting_model"
+	StageCopying     = "copying"
+	StageMoving      = "moving"
+	StageLinking     = "linking"
+	StageCloning     = "cloning"
+	StageRenaming    = "renaming"
+	StageExtracting  = "extracting"
+	StageCompressing = "compressing"
+	StageSidecar     = "writing_sidecar"
+	StageWebhook     = "calling_webhook"
+)
+
+// eventBufferSize 每个订阅者的缓冲区大小
+const eventBufferSize = 256
+
+type eventBus struct {
+	mu          sync.Mutex
+	nextID      int64
+	subscribers map[int64]chan models.Event
+}
+
+var events = &eventBus{subscribers: make(map[int64]chan models.Event)}
+
+// SubscribeEvents 订阅处理事件，返回事件通道与取消订阅函数
+func SubscribeEvents() (<-chan models.Event, func()) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	events.nextID++
+	id := events.nextID
+	ch := make(chan models.Event, eventBufferSize)
+	events.subscribers[id] = ch
+
+	return ch, func() {
+		events.mu.Lock()
+		defer events.mu.Unlock()
+		if _, ok := events.subscribers[id]; ok {
+			delete(events.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
+// PublishEvent 向所有订阅者广播事件
+func PublishEvent(event models.Event) {
+	if event.Time == "" {
+		event.Time = time.Now().Format(time.RFC3339Nano)
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	for _, ch := range events.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// 消费过慢时丢弃进度事件；其他事件挤掉最旧的一条，保证阶段和结果送达
+			if event.Type == EventProgress {
+				continue
+			}
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+}
+
+type eventScopeKey struct{}
+
+// eventScope 事件关联信息
+type eventScope struct {
+	RequestID string
+	JobID     string
+	FilePath  string
+}
+
+// WithEventScope 在 context 中记录请求 ID、任务 ID 和文件路径，后续事件自动携带
+func WithEventScope(ctx context.Context, requestID, jobID, filePath string) context.Context {
+	return context.WithValue(ctx, eventScopeKey{}, eventScope{
+		RequestID: requestID,
+		JobID:     jobID,
+		FilePath:  filePath,
+	})
+}
+
+// withEventFile 在保留请求 ID 和任务 ID 的前提下切换事件关联的文件
+func withEventFile(ctx context.Context, filePath string) context.Context {
+	scope, _ := ctx.Value(eventScopeKey{}).(eventScope)
+	return WithEventScope(ctx, scope.RequestID, scope.JobID, filePath)
+}
+
+// emitEvent 发布带有 context 关联信息的事件
+func emitEvent(ctx context.Context, eventType, stage, message string, progress float64) {
+	scope, _ := ctx.Value(eventScopeKey{}).(eventScope)
+	PublishEvent(models.Event{
+		Type:      eventType,
+		RequestID: scope.RequestID,
+		JobID:     scope.JobID,
+		FilePath:  scope.FilePath,
+		Stage:     stage,
+		Message:   message,
+		Progress:  progress,
+	})
+}
+
+// emitStage 发布阶段变化事件
+func emitStage(ctx context.Context, stage, message string) {
+	emitEvent(ctx, EventStage, stage, message, 0)
+}
+
+// copyProgress 返回按整数百分比节流的复制进度回调
+func copyProgress(ctx context.Context, stage string) ProgressFunc {
+	lastPercent := int64(-1)
+	return func(written, total int64) {
+		percent := int64(100)
+		if total > 0 {
+			percent = written * 100 / total
+		}
+		if percent == lastPercent {
+			return
+		}
+		lastPercent = percent
+		emitEvent(ctx, EventProgress, stage, "", float64(percent))
+	}
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 文件夹处理方式
+const (
+	FolderUnit   = "unit"   // 整个文件夹作为一个整体处理
+	FolderExpand = "expand" // 展开文件夹，逐个文件匹配规则
+)
+
+// IsValidFolderMode 判断文件夹处理方式是否合法（空值表示整体处理）
+func IsValidFolderMode(mode string) bool {
+	switch mode {
+	case "", FolderUnit, FolderExpand:
+		return true
+	default:
+		return false
+	}
+}
+
+// CopyPath 复制文件或文件夹
+func CopyPath(src, dst string, progress ProgressFunc) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return CopyDir(src, dst, progress)
+	}
+	return CopyFileWithProgress(src, dst, progress)
+}
+
+// MovePath 移动文件或文件夹
+func MovePath(src, dst string, progress ProgressFunc) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return MoveDir(src, dst, progress)
+	}
+	return MoveFileWithProgress(src, dst, progress)
+}
+
+// CopyDir 复制整个目录树：先写入目标目录旁的临时目录，全部成功后再重命名到位。
+// 符号链接按原样重建，不跟随；设备文件、管道等特殊文件会被跳过
+func CopyDir(src, dst string, progress ProgressFunc) error {
+	return copyDirWith(src, dst, progress, CopyFileWithProgress)
+}
+
+// copyDirWith 按 CopyDir 的方式复制目录树，单个文件使用 copyFile 写入（复制或克隆）
+func copyDirWith(src, dst string, progress ProgressFunc, copyFile func(src, dst string, progress ProgressFunc) error) error {
+	if isInsideSource(src, filepath.Dir(dst)) {
+		return fmt.Errorf("%w: 不能复制到文件夹 %s 自身之内", ErrActionUnsupported, src)
+	}
+	total, err := PathSize(src)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	var copied int64
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(tmpDir, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			// 保留属主写权限，否则无法继续写入只读目录中的内容
+			if rel == "." {
+				return os.Chmod(tmpDir, info.Mode().Perm()|0700)
+			}
+			return os.Mkdir(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			var fileProgress ProgressFunc
+			if progress != nil {
+				base := copied
+				fileProgress = func(written, _ int64) {
+					progress(base+written, total)
+				}
+			}
+			if err := copyFile(path, target, fileProgress); err != nil {
+				return err
+			}
+			copied += info.Size()
+			return nil
+		default:
+			log.Printf("跳过特殊文件: %s", path)
+			return nil
+		}
+	})
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	if err := replaceDir(tmpDir, dst); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	syncDir(filepath.Dir(dst))
+	return nil
+}
+
+// replaceDir 将临时目录重命名为目标目录，目标已存在时（覆盖策略）先挪开旧目录
+func replaceDir(tmpDir, dst string) error {
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		return os.Rename(tmpDir, dst)
+	}
+
+	backup := fmt.Sprintf("%s.old-%d", dst, os.Getpid())
+	if err := os.Rename(dst, backup); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpDir, dst); err != nil {
+		os.Rename(backup, dst)
+		return err
+	}
+	return os.RemoveAll(backup)
+}
+
+// MoveDir 移动目录（跨设备时回退为复制后删除源目录，每个文件都校验通过后才删除）
+func MoveDir(src, dst string, progress ProgressFunc) error {
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		if err := os.Rename(src, dst); err == nil {
+			return nil
+		}
+	}
+
+	if err := CopyDir(src, dst, progress); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(src)
+}
+
+// PathSize 计算文件或目录内常规文件的总字节数
+func PathSize(path string) (int64, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	if !info.IsDir() {
+		return info.Size(), nil
+	}
+
+	var total int64
+	err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// HashPath 计算文件或目录的 SHA-256。
+// 目录的哈希覆盖所有条目的相对路径、类型以及文件内容或链接目标；符号链接本身按链接目标计算
+func HashPath(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256([]byte("link\x00" + link))
+		return hex.EncodeToString(sum[:]), nil
+	}
+	if !info.IsDir() {
+		return HashFile(path)
+	}
+
+	var entries []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			entries = append(entries, rel+"\x00dir")
+		case d.Type()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, rel+"\x00link\x00"+link)
+		case d.Type().IsRegular():
+			hash, err := HashFile(p)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, rel+"\x00file\x00"+hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(entries)
+	hasher := sha256.New()
+	for _, entry := range entries {
+		hasher.Write([]byte(entry + "\n"))
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// listFolderFiles 列出目录下所有常规文件（递归，不跟随符号链接）
+func listFolderFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
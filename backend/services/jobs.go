@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"main/database"
+	"main/models"
+)
+
+// 任务状态
+const (
+	JobRunning   = "running"
+	JobPaused    = "paused"
+	JobCompleted = "completed"
+	JobCancelled = "cancelled"
+)
+
+// DefaultJobWorkers 默认并发处理的文件数
+const DefaultJobWorkers = 2
+
+// jobPollInterval 队列为空时的轮询间隔
+const jobPollInterval = 2 * time.Second
+
+// ErrJobNotFound 任务不存在
+var ErrJobNotFound = errors.New("任务不存在")
+
+// ErrJobState 任务当前状态不允许该操作
+var ErrJobState = errors.New("任务状态不允许该操作")
+
+// jobWake 唤醒空闲 worker
+var jobWake chan struct{}
+
+// jobCancels 正在处理的文件的取消函数，按任务 ID 分组
+var jobCancels = struct {
+	sync.Mutex
+	items map[string]map[int64]context.CancelFunc
+}{items: make(map[string]map[int64]context.CancelFunc)}
+
+// StartJobWorkers 启动任务 worker，并恢复上次退出时中断的任务
+func StartJobWorkers(workers int) error {
+	if workers <= 0 {
+		workers = DefaultJobWorkers
+	}
+
+	if err := database.ResetInterruptedJobItems(); err != nil {
+		return err
+	}
+
+	jobWake = make(chan struct{}, workers)
+	for i := 0; i < workers; i++ {
+		go runJobWorker()
+	}
+
+	log.Printf("⚙️  Job workers started: %d", workers)
+	return nil
+}
+
+// CreateJob 创建批量处理任务
+func CreateJob(req models.JobCreateRequest) (models.Job, error) {
+	job, err := database.CreateJob(models.Job{
+		Status: JobRunning,
+		UseAI:  req.UseAI,
+		Model:  req.Model,
+		RuleID: req.RuleID,
+	}, req.FilePaths)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	log.Printf("创建任务: %s (%d 个文件)", job.ID, len(req.FilePaths))
+	publishJobEvent(job.ID)
+	wakeJobWorkers()
+	return job, nil
+}
+
+// PauseJob 暂停任务，正在处理的文件会继续完成
+func PauseJob(id string) error {
+	return switchJobStatus(id, JobPaused, JobRunning)
+}
+
+// ResumeJob 恢复已暂停的任务
+func ResumeJob(id string) error {
+	if err := switchJobStatus(id, JobRunning, JobPaused); err != nil {
+		return err
+	}
+	wakeJobWorkers()
+	return nil
+}
+
+// CancelJob 取消任务：尚未开始的文件不再处理，正在处理的文件中止等待中的 AI 请求，未写入的文件保持原样
+func CancelJob(id string) error {
+	if err := switchJobStatus(id, JobCancelled, JobRunning, JobPaused); err != nil {
+		return err
+	}
+	if err := database.CancelJobItems(id); err != nil {
+		return err
+	}
+
+	jobCancels.Lock()
+	for _, cancel := range jobCancels.items[id] {
+		cancel()
+	}
+	jobCancels.Unlock()
+	return nil
+}
+
+// trackJobItem 登记正在处理的文件，返回的函数用于处理结束后注销
+func trackJobItem(item models.JobItem, cancel context.CancelFunc) func() {
+	jobCancels.Lock()
+	defer jobCancels.Unlock()
+
+	if jobCancels.items[item.JobID] == nil {
+		jobCancels.items[item.JobID] = make(map[int64]context.CancelFunc)
+	}
+	jobCancels.items[item.JobID][item.ID] = cancel
+
+	return func() {
+		jobCancels.Lock()
+		defer jobCancels.Unlock()
+		delete(jobCancels.items[item.JobID], item.ID)
+		if len(jobCancels.items[item.JobID]) == 0 {
+			delete(jobCancels.items, item.JobID)
+		}
+	}
+}
+
+func switchJobStatus(id string, to string, from ...string) error {
+	err := database.UpdateJobStatus(id, to, from...)
+	if err == nil {
+		publishJobEvent(id)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	// 区分任务不存在与状态不匹配
+	job, err := database.GetJob(id)
+	if err == sql.ErrNoRows {
+		return ErrJobNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: 当前状态为 %s", ErrJobState, job.Status)
+}
+
+func wakeJobWorkers() {
+	for i := 0; i < cap(jobWake); i++ {
+		select {
+		case jobWake <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+func runJobWorker() {
+	for {
+		item, err := database.ClaimNextJobItem()
+		if err != nil {
+			log.Printf("领取任务失败: %v", err)
+		}
+		if item == nil {
+			select {
+			case <-jobWake:
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+
+		processJobItem(*item)
+	}
+}
+
+func processJobItem(item models.JobItem) {
+	job, err := database.GetJob(item.JobID)
+	if err != nil {
+		log.Printf("读取任务失败: %v", err)
+		item.Status = "failed"
+		item.Message = err.Error()
+		database.FinishJobItem(item)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(WithEventScope(context.Background(), "", item.JobID, item.FilePath))
+	untrack := trackJobItem(item, cancel)
+	response, err := ProcessFile(ctx, models.FileProcessRequest{
+		FilePath: item.FilePath,
+		UseAI:    job.UseAI,
+		Model:    job.Model,
+		RuleID:   job.RuleID,
+	})
+	untrack()
+	cancel()
+
+	switch {
+	case errors.Is(err, ErrCancelled):
+		item.Status = "cancelled"
+		item.Message = err.Error()
+	case err != nil:
+		item.Status = "failed"
+		item.Message = err.Error()
+	default:
+		item.Status = response.Status
+		item.Destination = response.Destination
+		item.HistoryID = response.HistoryID
+	}
+
+	if err := database.FinishJobItem(item); err != nil {
+		log.Printf("保存任务结果失败: %v", err)
+	}
+	if err := database.CompleteJobIfDone(item.JobID); err != nil {
+		log.Printf("更新任务状态失败: %v", err)
+	}
+	publishJobEvent(item.JobID)
+}
+
+// publishJobEvent 广播任务当前进度
+func publishJobEvent(jobID string) {
+	job, err := database.GetJob(jobID)
+	if err != nil {
+		return
+	}
+
+	progress := float64(100)
+	if job.Total > 0 {
+		progress = float64(job.Total-job.Pending) * 100 / float64(job.Total)
+	}
+	PublishEvent(models.Event{
+		Type:     EventJob,
+		JobID:    job.ID,
+		Stage:    job.Status,
+		Message:  fmt.Sprintf("%d/%d", job.Total-job.Pending, job.Total),
+		Progress: progress,
+	})
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"main/models"
+)
+
+// 元数据保留结果
+const (
+	MetadataPreserved   = "preserved"
+	MetadataSkipped     = "skipped"     // 规则未要求保留
+	MetadataUnsupported = "unsupported" // 当前平台不支持
+	metadataFailed      = "failed: "
+)
+
+// entryMetadata 单个文件或目录的元数据
+type entryMetadata struct {
+	rel     string
+	symlink bool
+	atime   time.Time
+	mtime   time.Time
+	uid     int
+	gid     int
+	hasOwn  bool
+	xattrs  map[string][]byte
+	xattrOK bool
+}
+
+// metadataSnapshot 处理前采集的源文件元数据，移动或复制完成后写回目标
+type metadataSnapshot struct {
+	options models.PreserveOptions
+	entries []entryMetadata
+	errors  map[string]string
+}
+
+// capturePreservedMetadata 采集源文件（或目录树）需要保留的元数据
+func capturePreservedMetadata(src string, options models.PreserveOptions) *metadataSnapshot {
+	snapshot := &metadataSnapshot{options: options, errors: make(map[string]string)}
+	if !options.Times && !options.Xattrs && !options.Owner {
+		return snapshot
+	}
+
+	filepath.WalkDir(src, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return nil
+		}
+
+		entry := entryMetadata{
+			rel:     rel,
+			symlink: info.Mode()&os.ModeSymlink != 0,
+			atime:   fileAtime(info),
+			mtime:   info.ModTime(),
+		}
+		entry.uid, entry.gid, entry.hasOwn = fileOwner(info)
+		if options.Xattrs && !entry.symlink {
+			xattrs, err := readXattrs(path)
+			if err != nil {
+				snapshot.recordError("xattrs", err)
+			} else {
+				entry.xattrs = xattrs
+				entry.xattrOK = true
+			}
+		}
+		snapshot.entries = append(snapshot.entries, entry)
+		return nil
+	})
+
+	return snapshot
+}
+
+func (s *metadataSnapshot) recordError(kind string, err error) {
+	if _, exists := s.errors[kind]; !exists {
+		s.errors[kind] = err.Error()
+	}
+}
+
+// apply 将元数据写回目标，返回各类元数据的保留情况
+func (s *metadataSnapshot) apply(dst string) map[string]string {
+	// 先处理子项再处理父目录，避免写入子项后父目录的修改时间被刷新
+	entries := append([]entryMetadata(nil), s.entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		return len(entries[i].rel) > len(entries[j].rel)
+	})
+
+	for _, entry := range entries {
+		target := filepath.Join(dst, entry.rel)
+
+		if s.options.Xattrs && entry.xattrOK {
+			for name, value := range entry.xattrs {
+				if err := writeXattr(target, name, value); err != nil {
+					s.recordError("xattrs", err)
+				}
+			}
+		}
+		if s.options.Owner && entry.hasOwn {
+			if err := os.Lchown(target, entry.uid, entry.gid); err != nil {
+				s.recordError("owner", err)
+			}
+		}
+		// os.Chtimes 会跟随符号链接，链接本身的时间不做处理
+		if s.options.Times && !entry.symlink {
+			if err := os.Chtimes(target, entry.atime, entry.mtime); err != nil {
+				s.recordError("times", err)
+			}
+		}
+	}
+
+	return map[string]string{
+		"times":  s.status("times", s.options.Times, true),
+		"xattrs": s.status("xattrs", s.options.Xattrs, xattrsSupported),
+		"owner":  s.status("owner", s.options.Owner, ownerSupported),
+	}
+}
+
+func (s *metadataSnapshot) status(kind string, requested bool, supported bool) string {
+	switch {
+	case !requested:
+		return MetadataSkipped
+	case !supported:
+		return MetadataUnsupported
+	case s.errors[kind] != "":
+		return metadataFailed + s.errors[kind]
+	default:
+		return MetadataPreserved
+	}
+}
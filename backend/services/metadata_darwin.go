@@ -0,0 +1,15 @@
+package services
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileAtime 读取文件的访问时间
+func fileAtime(info os.FileInfo) time.Time {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(stat.Atimespec.Sec, stat.Atimespec.Nsec)
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,36 @@
+//go:build !linux && !darwin
+
+package services
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+const (
+	xattrsSupported = false
+	ownerSupported  = false
+)
+
+var errMetadataUnsupported = errors.New("当前平台不支持")
+
+// fileAtime 当前平台无法读取访问时间，使用修改时间代替
+func fileAtime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// fileOwner 当前平台不支持读取属主
+func fileOwner(info os.FileInfo) (uid int, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// readXattrs 当前平台不支持扩展属性
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, errMetadataUnsupported
+}
+
+// writeXattr 当前平台不支持扩展属性
+func writeXattr(path, name string, value []byte) error {
+	return errMetadataUnsupported
+}
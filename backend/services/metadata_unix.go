@@ -0,0 +1,71 @@
+//go:build linux || darwin
+
+package services
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	xattrsSupported = true
+	ownerSupported  = true
+)
+
+// fileOwner 读取文件的属主和属组
+func fileOwner(info os.FileInfo) (uid int, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// readXattrs 读取文件的全部扩展属性
+func readXattrs(path string) (map[string][]byte, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil {
+		if err == unix.ENOTSUP {
+			return map[string][]byte{}, nil
+		}
+		return nil, err
+	}
+
+	xattrs := make(map[string][]byte)
+	if size == 0 {
+		return xattrs, nil
+	}
+
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		valueSize, err := unix.Lgetxattr(path, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, valueSize)
+		if valueSize > 0 {
+			valueSize, err = unix.Lgetxattr(path, string(name), value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		xattrs[string(name)] = value[:valueSize]
+	}
+	return xattrs, nil
+}
+
+// writeXattr 写入单个扩展属性
+func writeXattr(path, name string, value []byte) error {
+	return unix.Lsetxattr(path, name, value, 0)
+}
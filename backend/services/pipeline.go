@@ -0,0 +1,542 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"main/database"
+	"main/models"
+)
+
+// ActionPipeline 规则配置了处理流水线时计划与历史记录使用的动作
+const ActionPipeline = "pipeline"
+
+// 流水线步骤类型，copy、move、symlink、hardlink、clone、extract、compress 与同名动作一致
+const (
+	StepRename  = "rename"  // 在当前所在目录内重命名
+	StepSidecar = "sidecar" // 在当前文件旁写入 <名称>.json 描述文件
+	StepWebhook = "webhook" // 向指定地址 POST 当前处理状态
+)
+
+// 步骤失败后的处理方式
+const (
+	OnErrorAbort    = "abort"    // 停止后续步骤，保留已完成的步骤
+	OnErrorContinue = "continue" // 记录失败并继续执行后续步骤
+	OnErrorRollback = "rollback" // 停止并按相反顺序还原已完成的步骤
+)
+
+// 步骤执行状态
+const (
+	StepSuccess    = "success"
+	StepSkipped    = "skipped"
+	StepFailed     = "failed"
+	StepRolledBack = "rolled_back"
+	StepNotRun     = "not_run"
+)
+
+const stepWebhookTimeout = 10 * time.Second
+
+// ValidateSteps 校验流水线配置，错误信息带有步骤序号
+func ValidateSteps(steps []models.RuleStep) error {
+	for i, step := range steps {
+		if err := validateStep(step); err != nil {
+			return fmt.Errorf("第 %d 步（%s）: %v", i+1, step.Type, err)
+		}
+	}
+	return nil
+}
+
+func validateStep(step models.RuleStep) error {
+	switch step.Type {
+	case StepRename, StepSidecar:
+		if step.Destination != "" {
+			return fmt.Errorf("不支持 destination")
+		}
+		if step.Type == StepSidecar && len(step.NameTemplate) > 0 {
+			return fmt.Errorf("不支持 name_template")
+		}
+	case ActionCopy, ActionMove, ActionSymlink, ActionHardlink, ActionClone, ActionExtract, ActionCompress:
+		if strings.TrimSpace(step.Destination) == "" {
+			return fmt.Errorf("缺少 destination")
+		}
+		if _, err := ResolveDestination(step.Destination, TemplateValues{Time: time.Now()}); err != nil {
+			return err
+		}
+	case StepWebhook:
+		if step.Destination != "" || len(step.NameTemplate) > 0 {
+			return fmt.Errorf("只支持 url 参数")
+		}
+		parsed, err := url.Parse(step.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("url 必须是 http 或 https 地址")
+		}
+	default:
+		return fmt.Errorf("不支持的步骤类型")
+	}
+
+	if step.Type != StepWebhook && step.URL != "" {
+		return fmt.Errorf("不支持 url")
+	}
+	if step.Type != ActionCompress && step.ArchiveFormat != "" {
+		return fmt.Errorf("不支持 archive_format")
+	}
+	if !IsValidCompressFormat(step.ArchiveFormat) {
+		return fmt.Errorf("不支持的打包格式: %s", step.ArchiveFormat)
+	}
+	if !IsValidConflictPolicy(step.ConflictPolicy) {
+		return fmt.Errorf("不支持的冲突处理策略: %s", step.ConflictPolicy)
+	}
+	switch step.OnError {
+	case "", OnErrorAbort, OnErrorContinue, OnErrorRollback:
+	default:
+		return fmt.Errorf("不支持的失败处理方式: %s", step.OnError)
+	}
+	return nil
+}
+
+// planPipeline 展开各步骤的目标目录与名称，并推算流水线结束后文件所在的位置
+func planPipeline(plan *models.FilePlan, steps []models.RuleStep, values TemplateValues, defaultBase string, isDir bool) (*models.FilePlan, error) {
+	plan.Action = ActionPipeline
+	plan.TrashOriginals = false
+	plan.ArchiveFormat = ""
+	plan.Steps = make([]models.PlanStep, 0, len(steps))
+
+	for i, step := range steps {
+		planned := models.PlanStep{
+			Type:           step.Type,
+			ConflictPolicy: step.ConflictPolicy,
+			ArchiveFormat:  step.ArchiveFormat,
+			URL:            step.URL,
+			OnError:        step.OnError,
+		}
+		if planned.ConflictPolicy == "" && step.Type != StepWebhook {
+			planned.ConflictPolicy = plan.ConflictPolicy
+		}
+		if planned.OnError == "" {
+			planned.OnError = OnErrorAbort
+		}
+		if step.Type == ActionCompress && planned.ArchiveFormat == "" {
+			planned.ArchiveFormat = ArchiveZip
+		}
+		if step.Destination != "" {
+			dest, err := ResolveDestination(step.Destination, values)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 步: %w", i+1, err)
+			}
+			planned.Destination = dest
+		}
+		if len(step.NameTemplate) > 0 {
+			planned.Name = BuildNameFromTemplate(step.NameTemplate, values)
+		} else if step.Type == StepRename {
+			planned.Name = defaultBase
+		}
+		plan.Steps = append(plan.Steps, planned)
+	}
+
+	// 只有 rename 和 move 会改变当前文件的位置
+	current := filepath.Clean(plan.OriginalPath)
+	for _, step := range plan.Steps {
+		switch step.Type {
+		case StepRename:
+			current = filepath.Join(filepath.Dir(current), stepTargetName(step, current, isDir))
+		case ActionMove:
+			current = filepath.Join(step.Destination, stepTargetName(step, current, isDir))
+		}
+	}
+	plan.Destination = current
+	plan.NewName = filepath.Base(current)
+	plan.WillWrite = true
+	plan.RemovesOriginal = current != filepath.Clean(plan.OriginalPath)
+	return plan, nil
+}
+
+// stepTargetName 步骤生成的文件名：计划中有名称时使用该名称，否则沿用当前名称
+func stepTargetName(step models.PlanStep, current string, isDir bool) string {
+	base := filepath.Base(current)
+	ext := filepath.Ext(base)
+	if isDir {
+		ext = ""
+	}
+
+	switch step.Type {
+	case ActionExtract:
+		if step.Name != "" {
+			return step.Name
+		}
+		return trimArchiveExt(base)
+	case ActionCompress:
+		name := step.Name
+		if name == "" {
+			name = strings.TrimSuffix(base, ext)
+		}
+		return name + "." + step.ArchiveFormat
+	case StepSidecar:
+		return base + ".json"
+	default:
+		if step.Name != "" {
+			return step.Name + ext
+		}
+		return base
+	}
+}
+
+// executePipeline 依次执行流水线中的步骤，每个步骤的结果都写入历史记录。
+// 按 continue 处理的步骤失败时记录状态为 partial；处理被取消时回滚已完成的步骤
+func executePipeline(ctx context.Context, plan *models.FilePlan, history models.HistoryRecord, response *models.FileProcessResponse) (*models.FileProcessResponse, error) {
+	results := make([]models.StepResult, len(plan.Steps))
+	for i, step := range plan.Steps {
+		results[i] = models.StepResult{Index: i + 1, Type: step.Type, Status: StepNotRun}
+	}
+
+	current := plan.OriginalPath
+	var stepErr error
+	var failed []string
+	for i, step := range plan.Steps {
+		if ctx.Err() != nil {
+			rollbackSteps(results[:i])
+			stepErr = cancelledError(ctx)
+			break
+		}
+
+		result := &results[i]
+		result.Source = current
+
+		err := runStep(ctx, plan, step, result, results[:i])
+		if err != nil {
+			log.Printf("流水线第 %d 步（%s）失败: %v", i+1, step.Type, err)
+			result.Status = StepFailed
+			result.Message = err.Error()
+			if errors.Is(err, ErrCancelled) || ctx.Err() != nil {
+				rollbackSteps(results[:i])
+				stepErr = cancelledError(ctx)
+				break
+			}
+			if step.OnError == OnErrorContinue {
+				failed = append(failed, fmt.Sprintf("第 %d 步（%s）: %v", i+1, step.Type, err))
+				continue
+			}
+			if step.OnError == OnErrorRollback {
+				rollbackSteps(results[:i])
+			}
+			stepErr = fmt.Errorf("第 %d 步（%s）失败: %w", i+1, step.Type, err)
+			break
+		}
+
+		if result.Status == StepSuccess && (step.Type == StepRename || step.Type == ActionMove) {
+			current = result.Output
+		}
+	}
+
+	// 回滚后文件回到原位置
+	if _, err := os.Lstat(current); err != nil {
+		current = plan.OriginalPath
+	}
+
+	history.Steps = results
+	history.NewPath, response.Destination = current, current
+	history.NewName, response.NewName = filepath.Base(current), filepath.Base(current)
+	_, err := os.Lstat(plan.OriginalPath)
+	history.OriginalRemoved = os.IsNotExist(err)
+	response.Steps = results
+
+	if stepErr != nil {
+		return failExecution(history, response, fmt.Errorf("文件处理失败: %w", stepErr))
+	}
+
+	history.Status = "success"
+	if len(failed) > 0 {
+		history.Status = "partial"
+		response.Error = "部分步骤失败: " + strings.Join(failed, "；")
+	}
+	response.Status = history.Status
+	response.HistoryID, _ = database.SaveHistory(history)
+
+	log.Printf("流水线处理文件: %s -> %s (%s)", plan.OriginalPath, current, history.Status)
+	return response, nil
+}
+
+// runStep 执行单个步骤，将输出位置与状态写入 result
+func runStep(ctx context.Context, plan *models.FilePlan, step models.PlanStep, result *models.StepResult, done []models.StepResult) error {
+	if step.Type == StepWebhook {
+		emitStage(ctx, StageWebhook, step.URL)
+		if err := callStepWebhook(ctx, step.URL, plan, result.Source, done); err != nil {
+			return err
+		}
+		result.Status = StepSuccess
+		return nil
+	}
+
+	info, err := os.Lstat(result.Source)
+	if err != nil {
+		return err
+	}
+
+	dir := step.Destination
+	if step.Type == StepRename || step.Type == StepSidecar {
+		dir = filepath.Dir(result.Source)
+	}
+	dest := filepath.Join(dir, stepTargetName(step, result.Source, info.IsDir()))
+
+	if step.Type == StepRename && dest == filepath.Clean(result.Source) {
+		result.Status = StepSkipped
+		result.Message = ResolutionUnchanged
+		return nil
+	}
+	if err := validateAction(step.Type, result.Source, info, dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建目标目录失败: %v", err)
+	}
+
+	conflict, err := ResolveConflict(result.Source, dest, step.ConflictPolicy)
+	if err != nil {
+		return fmt.Errorf("目标冲突处理失败: %v", err)
+	}
+	if !conflict.Proceed {
+		result.Status = StepSkipped
+		result.Output = conflict.Path
+		result.Message = conflict.Resolution
+		return nil
+	}
+	dest = conflict.Path
+
+	switch step.Type {
+	case StepRename:
+		emitStage(ctx, StageRenaming, dest)
+		err = MovePath(result.Source, dest, nil)
+	case ActionMove:
+		emitStage(ctx, StageMoving, dest)
+		err = MovePath(result.Source, dest, copyProgress(ctx, StageMoving))
+	case ActionSymlink:
+		emitStage(ctx, StageLinking, dest)
+		err = SymlinkPath(result.Source, dest)
+	case ActionHardlink:
+		emitStage(ctx, StageLinking, dest)
+		err = HardlinkPath(result.Source, dest)
+	case ActionClone:
+		emitStage(ctx, StageCloning, dest)
+		_, err = ClonePath(result.Source, dest, copyProgress(ctx, StageCloning))
+	case ActionExtract:
+		emitStage(ctx, StageExtracting, dest)
+		_, err = ExtractArchive(result.Source, dest, copyProgress(ctx, StageExtracting))
+	case ActionCompress:
+		emitStage(ctx, StageCompressing, dest)
+		_, err = CompressPath(result.Source, dest, step.ArchiveFormat, copyProgress(ctx, StageCompressing))
+	case StepSidecar:
+		emitStage(ctx, StageSidecar, dest)
+		err = writeSidecar(dest, plan, result.Source)
+	default:
+		emitStage(ctx, StageCopying, dest)
+		err = CopyPath(result.Source, dest, copyProgress(ctx, StageCopying))
+	}
+	if err != nil {
+		return err
+	}
+
+	result.Status = StepSuccess
+	result.Output = dest
+	if conflict.Resolution != "" && conflict.Resolution != ResolutionNone {
+		result.Message = conflict.Resolution
+	}
+	// 记录输出内容，撤销时校验未被修改
+	if hash, err := HashPath(dest); err == nil {
+		result.ContentHash = hash
+	} else {
+		log.Printf("读取步骤输出状态失败: %v", err)
+	}
+	return nil
+}
+
+// sidecarContent 描述文件的内容
+type sidecarContent struct {
+	OriginalPath string             `json:"original_path"`
+	OriginalName string             `json:"original_name"`
+	Path         string             `json:"path"`
+	Rule         string             `json:"rule"`
+	ContentHash  string             `json:"content_hash,omitempty"`
+	ProcessedAt  string             `json:"processed_at"`
+	AIAnalysis   *models.AIAnalysis `json:"ai_analysis,omitempty"`
+}
+
+// writeSidecar 先写入临时文件再重命名到位，避免留下不完整的描述文件
+func writeSidecar(dst string, plan *models.FilePlan, current string) error {
+	content := sidecarContent{
+		OriginalPath: plan.OriginalPath,
+		OriginalName: plan.OriginalName,
+		Path:         current,
+		Rule:         plan.RuleUsed,
+		ProcessedAt:  time.Now().Format(time.RFC3339),
+		AIAnalysis:   plan.AIAnalysis,
+	}
+	if hash, err := HashPath(current); err == nil {
+		content.ContentHash = hash
+	}
+
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	os.Chmod(tmp.Name(), 0644)
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// stepWebhookPayload webhook 步骤发送的内容
+type stepWebhookPayload struct {
+	Event        string              `json:"event"`
+	Rule         string              `json:"rule"`
+	OriginalPath string              `json:"original_path"`
+	Path         string              `json:"path"`
+	Steps        []models.StepResult `json:"steps"`
+	AIAnalysis   *models.AIAnalysis  `json:"ai_analysis,omitempty"`
+	Timestamp    string              `json:"timestamp"`
+}
+
+// callStepWebhook 发送当前处理状态，非 2xx 响应视为失败
+func callStepWebhook(ctx context.Context, target string, plan *models.FilePlan, current string, done []models.StepResult) error {
+	payload := stepWebhookPayload{
+		Event:        "pipeline.step",
+		Rule:         plan.RuleUsed,
+		OriginalPath: plan.OriginalPath,
+		Path:         current,
+		Steps:        done,
+		AIAnalysis:   plan.AIAnalysis,
+		Timestamp:    time.Now().Format(time.RFC3339),
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, stepWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求 webhook 失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// revertStep 还原单个已成功的步骤：移动过的文件移回原处，生成的文件删除；webhook 无法撤回
+func revertStep(result models.StepResult) error {
+	switch result.Type {
+	case StepWebhook:
+		return nil
+	case StepRename, ActionMove:
+		if _, err := os.Lstat(result.Source); err == nil {
+			return fmt.Errorf("原路径已存在文件 %s", result.Source)
+		}
+		if err := os.MkdirAll(filepath.Dir(result.Source), 0755); err != nil {
+			return err
+		}
+		return MovePath(result.Output, result.Source, nil)
+	default:
+		return os.RemoveAll(result.Output)
+	}
+}
+
+// rollbackSteps 按相反顺序还原已成功的步骤
+func rollbackSteps(results []models.StepResult) {
+	for i := len(results) - 1; i >= 0; i-- {
+		result := &results[i]
+		if result.Status != StepSuccess {
+			continue
+		}
+		if err := revertStep(*result); err != nil {
+			log.Printf("回滚第 %d 步失败: %v", result.Index, err)
+			result.Message = "回滚失败: " + err.Error()
+			continue
+		}
+		result.Status = StepRolledBack
+	}
+}
+
+// undoPipeline 撤销流水线记录：先校验仍在原处的输出未被修改，再按相反顺序还原
+func undoPipeline(record models.HistoryRecord) error {
+	undoable := false
+	for i, result := range record.Steps {
+		if result.Status != StepSuccess || result.Type == StepWebhook {
+			continue
+		}
+		undoable = true
+		if movedByLaterStep(record.Steps, i) {
+			continue
+		}
+		if result.ContentHash == "" {
+			return fmt.Errorf("%w: 第 %d 步缺少校验信息", ErrUndoRejected, result.Index)
+		}
+		hash, err := HashPath(result.Output)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: 第 %d 步的输出不存在 %s", ErrUndoRejected, result.Index, result.Output)
+		}
+		if err != nil {
+			return err
+		}
+		if hash != result.ContentHash {
+			return fmt.Errorf("%w: 第 %d 步的输出已被修改 %s", ErrUndoRejected, result.Index, result.Output)
+		}
+	}
+	if !undoable {
+		return fmt.Errorf("%w: 没有可撤销的步骤", ErrUndoRejected)
+	}
+
+	for i := len(record.Steps) - 1; i >= 0; i-- {
+		result := record.Steps[i]
+		if result.Status != StepSuccess {
+			continue
+		}
+		if err := revertStep(result); err != nil {
+			return fmt.Errorf("撤销第 %d 步失败: %v", result.Index, err)
+		}
+	}
+	return database.MarkHistoryUndone(record.ID)
+}
+
+// movedByLaterStep 判断步骤的输出是否被后续的 rename 或 move 移走
+func movedByLaterStep(steps []models.StepResult, index int) bool {
+	for _, later := range steps[index+1:] {
+		if later.Status == StepSuccess && (later.Type == StepRename || later.Type == ActionMove) &&
+			later.Source == steps[index].Output {
+			return true
+		}
+	}
+	return false
+}
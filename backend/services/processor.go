@@ -0,0 +1,553 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"main/database"
+	"main/models"
+)
+
+// ErrFileNotFound 待处理文件不存在
+var ErrFileNotFound = errors.New("File not found")
+
+// ErrRuleNotFound 指定的规则不存在
+var ErrRuleNotFound = errors.New("规则不存在")
+
+// ErrCancelled 处理被取消（请求断开或任务被取消）
+var ErrCancelled = errors.New("处理已取消")
+
+// cancelledError 将 ctx 的取消原因包装为 ErrCancelled
+func cancelledError(ctx context.Context) error {
+	return fmt.Errorf("%w: %v", ErrCancelled, ctx.Err())
+}
+
+// PlanFile 生成文件处理计划（规则匹配、AI 分析、命名与冲突判断），不修改文件系统
+func PlanFile(ctx context.Context, req models.FileProcessRequest) (*models.FilePlan, error) {
+	// 检查文件是否存在
+	info, err := os.Stat(req.FilePath)
+	if os.IsNotExist(err) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 获取文件名和扩展名（文件夹不区分扩展名）
+	originalName := filepath.Base(req.FilePath)
+	ext := filepath.Ext(originalName)
+	if info.IsDir() {
+		ext = ""
+	}
+	nameWithoutExt := strings.TrimSuffix(originalName, ext)
+	fileType, mimeType := detectFileKind(req.FilePath, info)
+
+	// 查找规则
+	emitStage(ctx, StageMatching, "")
+	var rule *models.Rule
+	if req.RuleID != "" {
+		foundRule, err := database.GetRule(req.RuleID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, ErrRuleNotFound
+			}
+			return nil, fmt.Errorf("获取规则失败: %v", err)
+		}
+		rule = &foundRule
+	} else {
+		rules, err := database.GetRules()
+		if err == nil {
+			rule = MatchRuleForFile(req.FilePath, rules)
+		}
+	}
+
+	plan := &models.FilePlan{
+		OriginalPath: req.FilePath,
+		OriginalName: originalName,
+		RuleUsed:     "默认规则",
+		FileType:     fileType,
+		MIMEType:     mimeType,
+	}
+
+	action := ActionCopy
+	keepOriginal := false
+	conflictPolicy := ConflictRename
+	folderMode := FolderUnit
+	dateSource := "current"
+	nameTemplate := []string{}
+	useAI := req.UseAI
+
+	// 目标目录
+	destDir := defaultDestination()
+
+	if rule != nil {
+		plan.RuleID = rule.ID
+		if rule.Name != "" {
+			plan.RuleUsed = rule.Name
+		}
+		if rule.Action != "" {
+			action = rule.Action
+		}
+		if rule.Destination != "" {
+			destDir = rule.Destination
+		}
+		keepOriginal = rule.KeepOriginal
+		if rule.ConflictPolicy != "" {
+			conflictPolicy = rule.ConflictPolicy
+		}
+		if rule.FolderMode != "" {
+			folderMode = rule.FolderMode
+		}
+		if rule.DateSource != "" {
+			dateSource = rule.DateSource
+		}
+		if len(rule.NameTemplate) > 0 {
+			nameTemplate = rule.NameTemplate
+		}
+		if rule.AIEnabled {
+			useAI = true
+		}
+	}
+
+	// 配置了处理流水线时按步骤执行，规则的 action 不再生效
+	if rule != nil && len(rule.Steps) > 0 {
+		action = ActionPipeline
+	}
+
+	plan.Action = effectiveAction(action, keepOriginal)
+	plan.ConflictPolicy = conflictPolicy
+	if rule != nil {
+		plan.Preserve = rule.Preserve
+		plan.TrashOriginals = plan.Action == ActionMove && rule.TrashOriginals
+	}
+	if plan.Action == ActionCompress {
+		plan.ArchiveFormat = ArchiveZip
+		if rule != nil && rule.ArchiveFormat != "" {
+			plan.ArchiveFormat = rule.ArchiveFormat
+		}
+	}
+
+	// 解压到以压缩包名称（去掉 .tar.gz 等复合扩展名）命名的文件夹；打包后的扩展名由格式决定
+	switch plan.Action {
+	case ActionExtract:
+		nameWithoutExt = trimArchiveExt(originalName)
+		ext = ""
+	case ActionCompress:
+		ext = "." + plan.ArchiveFormat
+	}
+
+	// 展开文件夹：其中每个文件单独匹配规则
+	if info.IsDir() && folderMode == FolderExpand {
+		return planFolderEntries(ctx, req, plan)
+	}
+
+	// AI 分析结果
+	aiName := ""
+	if useAI {
+		emitStage(ctx, StageAnalyzing, "")
+		analysis, err := AnalyzeFile(ctx, req.FilePath, req.Model)
+		if ctx.Err() != nil {
+			return nil, cancelledError(ctx)
+		}
+		if err != nil {
+			log.Printf("AI 分析失败: %v", err)
+			plan.AIAnalysis = &models.AIAnalysis{
+				SuggestedName: nameWithoutExt,
+				Category:      "文档",
+				Confidence:    0.5,
+			}
+			aiName = plan.AIAnalysis.SuggestedName
+		} else {
+			plan.AIAnalysis = analysis
+			if analysis.SuggestedName != "" {
+				aiName = analysis.SuggestedName
+			}
+		}
+	}
+
+	// 生成新文件名
+	fileDate := SelectTimestamp(req.FilePath, dateSource)
+	values := TemplateValues{
+		OriginalName: originalName,
+		BaseName:     nameWithoutExt,
+		AIName:       aiName,
+		FileType:     fileType,
+		Time:         fileDate,
+	}
+	if plan.AIAnalysis != nil {
+		values.AICategory = plan.AIAnalysis.Category
+	}
+	newBase := buildNewBase(nameTemplate, values)
+
+	if plan.Action == ActionPipeline {
+		return planPipeline(plan, rule.Steps, values, newBase, info.IsDir())
+	}
+
+	// 目标目录可包含 {YYYY}、{ai_category} 等占位符，按文件展开
+	destDir, err = ResolveDestination(destDir, values)
+	if err != nil {
+		return nil, err
+	}
+	// 原地重命名：目标目录即文件当前所在目录
+	if plan.Action == ActionInPlace {
+		destDir = filepath.Dir(req.FilePath)
+	}
+	destPath := filepath.Join(destDir, newBase+ext)
+
+	// 目标就是文件当前的位置（原地重命名时名称未变化，或目标目录即文件所在目录），无需处理
+	if destPath == filepath.Clean(req.FilePath) {
+		plan.Destination = destPath
+		plan.NewName = originalName
+		plan.Conflict = ResolutionUnchanged
+		return plan, nil
+	}
+
+	if err := validateAction(plan.Action, req.FilePath, info, destDir); err != nil {
+		return nil, err
+	}
+
+	// 处理目标冲突
+	conflict, err := ResolveConflict(req.FilePath, destPath, conflictPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("目标冲突处理失败: %v", err)
+	}
+	plan.Destination = conflict.Path
+	plan.NewName = filepath.Base(conflict.Path)
+	plan.Conflict = conflict.Resolution
+	plan.WillWrite = conflict.Proceed
+
+	// 移动或原地重命名时，写入目标或丢弃重复文件都会删除原文件
+	plan.RemovesOriginal = movesOriginal(plan.Action) &&
+		(conflict.Proceed || conflict.Resolution == ResolutionDuplicate)
+
+	return plan, nil
+}
+
+// planFolderEntries 为文件夹中的每个文件生成处理计划
+func planFolderEntries(ctx context.Context, req models.FileProcessRequest, plan *models.FilePlan) (*models.FilePlan, error) {
+	files, err := listFolderFiles(req.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件夹失败: %v", err)
+	}
+
+	plan.Expand = true
+	plan.Destination = req.FilePath
+	plan.NewName = plan.OriginalName
+	plan.Conflict = ResolutionNone
+	for _, file := range files {
+		childReq := req
+		childReq.FilePath = file
+		childReq.RuleID = ""
+
+		child, err := PlanFile(withEventFile(ctx, file), childReq)
+		if errors.Is(err, ErrCancelled) {
+			return nil, err
+		}
+		if err != nil {
+			log.Printf("文件 %s 生成处理计划失败: %v", file, err)
+			continue
+		}
+		plan.Children = append(plan.Children, *child)
+	}
+
+	return plan, nil
+}
+
+// ProcessFile 生成处理计划并立即执行，处理结果通过事件通知订阅者。
+// 被取消的处理不发送 webhook
+func ProcessFile(ctx context.Context, req models.FileProcessRequest) (*models.FileProcessResponse, error) {
+	plan, err := PlanFile(ctx, req)
+	if err != nil {
+		emitEvent(ctx, EventFailed, "", err.Error(), 0)
+		if !errors.Is(err, ErrCancelled) {
+			ruleID, ruleName := failedPlanRule(req)
+			FireWebhooks(WebhookEventFailed, ruleID, 0, failedResponse(req.FilePath, ruleName, err), err.Error())
+		}
+		return nil, err
+	}
+
+	// 计划生成期间（通常是等待 AI）被取消时不再修改文件
+	if ctx.Err() != nil {
+		err := cancelledError(ctx)
+		emitEvent(ctx, EventFailed, "", err.Error(), 0)
+		return nil, err
+	}
+
+	response, err := ExecutePlan(ctx, plan)
+	if err != nil {
+		emitEvent(ctx, EventFailed, "", err.Error(), 0)
+		if !errors.Is(err, ErrCancelled) {
+			FireWebhooks(WebhookEventFailed, plan.RuleID, response.HistoryID, response, err.Error())
+		}
+		return nil, err
+	}
+
+	emitEvent(ctx, EventCompleted, "", response.Destination, 100)
+	fireCompletedWebhooks(plan.RuleID, response)
+	return response, nil
+}
+
+// failedPlanRule 生成计划失败时事件所属的规则：指定了规则时为该规则，否则为文件匹配到的规则
+func failedPlanRule(req models.FileProcessRequest) (string, string) {
+	if req.RuleID != "" {
+		if rule, err := database.GetRule(req.RuleID); err == nil {
+			return rule.ID, rule.Name
+		}
+		return req.RuleID, ""
+	}
+	rules, err := database.GetRules()
+	if err != nil {
+		return "", ""
+	}
+	if rule := MatchRuleForFile(req.FilePath, rules); rule != nil {
+		return rule.ID, rule.Name
+	}
+	return "", ""
+}
+
+// failedResponse 处理失败时 webhook 中携带的结果
+func failedResponse(path, ruleUsed string, err error) *models.FileProcessResponse {
+	return &models.FileProcessResponse{
+		OriginalPath: path,
+		OriginalName: filepath.Base(path),
+		RuleUsed:     ruleUsed,
+		Status:       "failed",
+		Error:        err.Error(),
+	}
+}
+
+// ExecutePlan 按计划执行文件操作并保存历史记录。失败时同样返回结果，其中带有失败历史记录的 ID
+func ExecutePlan(ctx context.Context, plan *models.FilePlan) (*models.FileProcessResponse, error) {
+	history := models.HistoryRecord{
+		OriginalPath: plan.OriginalPath,
+		OriginalName: plan.OriginalName,
+		NewPath:      plan.Destination,
+		NewName:      plan.NewName,
+		RuleName:     plan.RuleUsed,
+		RuleID:       plan.RuleID,
+		Action:       plan.Action,
+		Conflict:     plan.Conflict,
+		MIMEType:     plan.MIMEType,
+	}
+
+	response := &models.FileProcessResponse{
+		OriginalPath: plan.OriginalPath,
+		OriginalName: plan.OriginalName,
+		NewName:      plan.NewName,
+		Destination:  plan.Destination,
+		RuleUsed:     plan.RuleUsed,
+		Conflict:     plan.Conflict,
+		AIAnalysis:   plan.AIAnalysis,
+	}
+
+	if plan.Expand {
+		return executeFolderEntries(ctx, plan, response)
+	}
+	if plan.Action == ActionPipeline {
+		return executePipeline(ctx, plan, history, response)
+	}
+
+	// 计划生成后目标可能已被占用（同批次的其他文件），写入前重新检查冲突
+	if plan.WillWrite && plan.Conflict != ResolutionOverwritten {
+		if _, err := os.Lstat(plan.Destination); err == nil {
+			conflict, err := ResolveConflict(plan.OriginalPath, plan.Destination, plan.ConflictPolicy)
+			if err != nil {
+				return failExecution(history, response, fmt.Errorf("目标冲突处理失败: %v", err))
+			}
+			plan.Destination = conflict.Path
+			plan.NewName = filepath.Base(conflict.Path)
+			plan.Conflict = conflict.Resolution
+			plan.WillWrite = conflict.Proceed
+			plan.RemovesOriginal = movesOriginal(plan.Action) &&
+				(conflict.Proceed || conflict.Resolution == ResolutionDuplicate)
+
+			history.NewPath, response.Destination = plan.Destination, plan.Destination
+			history.NewName, response.NewName = plan.NewName, plan.NewName
+			history.Conflict, response.Conflict = plan.Conflict, plan.Conflict
+		}
+	}
+
+	if !plan.WillWrite {
+		// 内容完全相同的重复文件，移动模式下直接丢弃源文件（或放入回收站）
+		if plan.RemovesOriginal {
+			if plan.TrashOriginals {
+				trashPath, err := MoveToTrash(plan.OriginalPath)
+				if err != nil {
+					log.Printf("重复文件放入回收站失败: %v", err)
+				}
+				history.TrashPath = trashPath
+			} else if err := os.RemoveAll(plan.OriginalPath); err != nil {
+				log.Printf("删除重复文件失败: %v", err)
+			}
+		}
+		history.Status = "skipped"
+		response.Status = "skipped"
+		response.HistoryID, _ = database.SaveHistory(history)
+		log.Printf("跳过文件: %s (%s)", plan.OriginalPath, plan.Conflict)
+		return response, nil
+	}
+
+	// 确保目标目录存在（目标目录模板可能生成新的子目录）
+	if err := os.MkdirAll(filepath.Dir(plan.Destination), 0755); err != nil {
+		return failExecution(history, response, fmt.Errorf("创建目标目录失败: %v", err))
+	}
+
+	// 源文件在移动后不再存在，先采集需要保留的元数据；链接与原文件共享元数据，无需保留，
+	// 解压和打包生成的是新内容，同样不保留
+	preserve := plan.Preserve
+	switch plan.Action {
+	case ActionSymlink, ActionHardlink, ActionExtract, ActionCompress:
+		preserve = models.PreserveOptions{}
+	}
+	metadata := capturePreservedMetadata(plan.OriginalPath, preserve)
+
+	var processErr error
+	var cloneMethod string
+	entries := -1
+	originalRemoved := plan.RemovesOriginal
+	switch {
+	case plan.Action == ActionMove && plan.TrashOriginals:
+		emitStage(ctx, StageMoving, plan.Destination)
+		history.TrashPath, processErr = MovePathToTrash(plan.OriginalPath, plan.Destination, copyProgress(ctx, StageMoving))
+		if errors.Is(processErr, ErrTrashFailed) {
+			// 目标已写入且校验通过，原文件保持原样
+			log.Printf("%v，保留原文件: %s", processErr, plan.OriginalPath)
+			originalRemoved = false
+			processErr = nil
+		}
+	case plan.Action == ActionMove:
+		emitStage(ctx, StageMoving, plan.Destination)
+		processErr = MovePath(plan.OriginalPath, plan.Destination, copyProgress(ctx, StageMoving))
+	case plan.Action == ActionInPlace:
+		emitStage(ctx, StageRenaming, plan.Destination)
+		processErr = MovePath(plan.OriginalPath, plan.Destination, nil)
+	case plan.Action == ActionSymlink:
+		emitStage(ctx, StageLinking, plan.Destination)
+		processErr = SymlinkPath(plan.OriginalPath, plan.Destination)
+	case plan.Action == ActionHardlink:
+		emitStage(ctx, StageLinking, plan.Destination)
+		processErr = HardlinkPath(plan.OriginalPath, plan.Destination)
+	case plan.Action == ActionClone:
+		emitStage(ctx, StageCloning, plan.Destination)
+		cloneMethod, processErr = ClonePath(plan.OriginalPath, plan.Destination, copyProgress(ctx, StageCloning))
+	case plan.Action == ActionExtract:
+		emitStage(ctx, StageExtracting, plan.Destination)
+		entries, processErr = ExtractArchive(plan.OriginalPath, plan.Destination, copyProgress(ctx, StageExtracting))
+	case plan.Action == ActionCompress:
+		emitStage(ctx, StageCompressing, plan.Destination)
+		entries, processErr = CompressPath(plan.OriginalPath, plan.Destination, plan.ArchiveFormat, copyProgress(ctx, StageCompressing))
+	default:
+		emitStage(ctx, StageCopying, plan.Destination)
+		processErr = CopyPath(plan.OriginalPath, plan.Destination, copyProgress(ctx, StageCopying))
+	}
+
+	if processErr != nil {
+		log.Printf("文件处理失败: %v", processErr)
+		return failExecution(history, response, fmt.Errorf("文件处理失败: %w", processErr))
+	}
+
+	history.Metadata = metadata.apply(plan.Destination)
+	if cloneMethod != "" {
+		history.Metadata["clone"] = cloneMethod
+	}
+	if entries >= 0 {
+		format := plan.ArchiveFormat
+		if plan.Action == ActionExtract {
+			format = ArchiveFormatOf(plan.OriginalPath)
+		}
+		history.Metadata["format"] = format
+		history.Metadata["entries"] = strconv.Itoa(entries)
+	}
+
+	// 记录写入后的目标状态，供撤销时校验
+	history.Status = "success"
+	response.Status = "success"
+	history.OriginalRemoved = originalRemoved
+	if hash, size, modTime, err := FileState(plan.Destination); err == nil {
+		history.ContentHash = hash
+		history.Size = size
+		history.ModTime = modTime
+	} else {
+		log.Printf("读取目标文件状态失败: %v", err)
+	}
+
+	// 保存到历史记录
+	response.HistoryID, _ = database.SaveHistory(history)
+
+	log.Printf("处理文件: %s -> %s", plan.OriginalPath, plan.Destination)
+	return response, nil
+}
+
+// failExecution 保存失败的历史记录，返回带有其 ID 的失败结果
+func failExecution(history models.HistoryRecord, response *models.FileProcessResponse, err error) (*models.FileProcessResponse, error) {
+	history.Status = "failed"
+	response.Status = "failed"
+	response.Error = err.Error()
+	response.HistoryID, _ = database.SaveHistory(history)
+	return response, err
+}
+
+// defaultDestination 没有匹配到规则或规则未设置目标目录时的目标目录
+func defaultDestination() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, "Documents", "BlackHole")
+}
+
+// effectiveAction 规则动作的实际执行方式：保留原文件的 move 按 copy 处理，未知动作按 copy 处理
+func effectiveAction(action string, keepOriginal bool) string {
+	switch action {
+	case ActionMove:
+		if keepOriginal {
+			return ActionCopy
+		}
+		return ActionMove
+	case ActionSymlink, ActionHardlink, ActionClone, ActionInPlace, ActionExtract, ActionCompress, ActionPipeline:
+		return action
+	default:
+		return ActionCopy
+	}
+}
+
+// buildNewBase 生成新名称（不含扩展名）：有命名模板时按模板，否则为“日期_原名称或 AI 名称”
+func buildNewBase(nameTemplate []string, values TemplateValues) string {
+	if len(nameTemplate) > 0 {
+		return BuildNameFromTemplate(nameTemplate, values)
+	}
+	base := values.BaseName
+	if values.AIName != "" {
+		base = values.AIName
+	}
+	return fmt.Sprintf("%s_%s", values.Time.Format("2006-01-02"), base)
+}
+
+// executeFolderEntries 依次执行文件夹中每个文件的处理计划，每个文件按各自的规则单独发送 webhook
+func executeFolderEntries(ctx context.Context, plan *models.FilePlan, response *models.FileProcessResponse) (*models.FileProcessResponse, error) {
+	response.Status = "success"
+	for i := range plan.Children {
+		child := &plan.Children[i]
+		childCtx := withEventFile(ctx, child.OriginalPath)
+
+		result, err := ExecutePlan(childCtx, child)
+		if err != nil {
+			emitEvent(childCtx, EventFailed, "", err.Error(), 0)
+			if !errors.Is(err, ErrCancelled) {
+				FireWebhooks(WebhookEventFailed, child.RuleID, result.HistoryID, result, err.Error())
+			}
+			response.Children = append(response.Children, *result)
+			continue
+		}
+		emitEvent(childCtx, EventCompleted, "", result.Destination, 100)
+		fireCompletedWebhooks(child.RuleID, result)
+		response.Children = append(response.Children, *result)
+	}
+
+	log.Printf("展开处理文件夹: %s (%d 个文件)", plan.OriginalPath, len(plan.Children))
+	return response, nil
+}
@@ -0,0 +1,10 @@
+//go:build darwin
+
+package services
+
+import "golang.org/x/sys/unix"
+
+// reflink 通过 clonefile 克隆文件（APFS）
+func reflink(src, dst string) error {
+	return unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW)
+}
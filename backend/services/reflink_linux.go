@@ -0,0 +1,33 @@
+//go:build linux
+
+package services
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink 通过 FICLONE 克隆文件（btrfs、xfs 等支持写时复制的文件系统）
+func reflink(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
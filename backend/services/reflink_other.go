@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package services
+
+import "errors"
+
+// reflink 当前平台不支持克隆，调用方回退为复制
+func reflink(src, dst string) error {
+	return errors.New("当前平台不支持克隆")
+}
@@ -1,35 +1,129 @@
 package services
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"main/database"
 	"main/models"
 )
 
-func MatchRuleForFile(filePath string, rules []models.Rule) *models.Rule {
-	info, err := os.Stat(filePath)
+// ErrInvalidRuleOrder 规则顺序列表与现有规则不一致
+var ErrInvalidRuleOrder = errors.New("规则顺序无效")
+
+// ValidateRule 校验规则配置
+func ValidateRule(rule models.Rule) error {
+	if !IsValidAction(rule.Action) {
+		return fmt.Errorf("不支持的动作: %s", rule.Action)
+	}
+	if !IsValidCompressFormat(rule.ArchiveFormat) {
+		return fmt.Errorf("不支持的打包格式: %s", rule.ArchiveFormat)
+	}
+	if !IsValidConflictPolicy(rule.ConflictPolicy) {
+		return fmt.Errorf("不支持的冲突处理策略: %s", rule.ConflictPolicy)
+	}
+	if !IsValidFolderMode(rule.FolderMode) {
+		return fmt.Errorf("不支持的文件夹处理方式: %s", rule.FolderMode)
+	}
+	if _, err := ResolveDestination(rule.Destination, TemplateValues{Time: time.Now()}); err != nil {
+		return err
+	}
+	if err := ValidateConditions(rule.Conditions); err != nil {
+		return err
+	}
+	if err := ValidateConditionTree(rule.ConditionTree); err != nil {
+		return err
+	}
+	return ValidateSteps(rule.Steps)
+}
+
+// MergeRuleUpdate 将更新请求合并到现有规则：请求中出现的顶层字段整体替换原值（conditions 等对象不逐项合并），
+// 未出现的字段保持不变，避免只认识部分字段的客户端把其余配置重置为零值
+func MergeRuleUpdate(existing models.Rule, body []byte) (models.Rule, error) {
+	var update map[string]json.RawMessage
+	if err := json.Unmarshal(body, &update); err != nil {
+		return models.Rule{}, err
+	}
+	if update == nil {
+		return models.Rule{}, errors.New("请求体必须是 JSON 对象")
+	}
+
+	current, err := json.Marshal(existing)
 	if err != nil {
-		return nil
+		return models.Rule{}, err
+	}
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(current, &merged); err != nil {
+		return models.Rule{}, err
+	}
+	for key, value := range update {
+		merged[key] = value
 	}
 
-	fileType := detectFileType(filePath, info)
-	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(filePath)), ".")
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return models.Rule{}, err
+	}
+	var rule models.Rule
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return models.Rule{}, err
+	}
+	return rule, nil
+}
 
-	for i := range rules {
-		rule := &rules[i]
-		if !rule.Enabled {
-			continue
+// ReorderRules 按给定 ID 顺序设置规则优先级，ID 列表必须恰好包含全部规则
+func ReorderRules(ids []string) error {
+	rules, err := database.GetRules()
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		existing[rule.ID] = true
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return fmt.Errorf("%w: 规则 %s 重复", ErrInvalidRuleOrder, id)
 		}
-		if rule.AllowAllFiles {
-			return rule
+		if !existing[id] {
+			return fmt.Errorf("%w: 未知规则 %s", ErrInvalidRuleOrder, id)
 		}
-		if ext != "" && matchExtension(ext, rule.CustomExtensions) {
-			return rule
+		seen[id] = true
+	}
+	for _, rule := range rules {
+		if !seen[rule.ID] {
+			return fmt.Errorf("%w: 缺少规则 %s", ErrInvalidRuleOrder, rule.ID)
 		}
-		if fileType != "" && containsString(rule.FileTypes, fileType) {
+	}
+
+	if err := database.SetRuleOrder(ids); err != nil {
+		if err == sql.ErrNoRows {
+			// 校验之后规则被并发删除
+			return fmt.Errorf("%w: 规则列表已变化，请刷新后重试", ErrInvalidRuleOrder)
+		}
+		return err
+	}
+	return nil
+}
+
+// MatchRuleForFile 按优先级返回第一条匹配的规则，兜底规则排在最后且匹配所有文件
+func MatchRuleForFile(filePath string, rules []models.Rule) *models.Rule {
+	facts, err := CollectFileFacts(filePath)
+	if err != nil {
+		return nil
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Enabled && ruleMatches(*rule, facts) {
 			return rule
 		}
 	}
@@ -37,42 +131,128 @@ func MatchRuleForFile(filePath string, rules []models.Rule) *models.Rule {
 	return nil
 }
 
-func BuildNameFromTemplate(template []string, originalName string, aiName string, t time.Time) string {
+// ruleMatches 文件类型或扩展名命中，且满足全部附加条件与条件树。
+// 没有配置文件类型和扩展名、只配置了条件的规则只按条件判断
+func ruleMatches(rule models.Rule, facts *FileFacts) bool {
+	return matchesFileKind(rule, facts) &&
+		MatchConditions(rule.Conditions, facts) &&
+		MatchConditionTree(rule.ConditionTree, facts)
+}
+
+// matchesFileKind 按全部文件、扩展名或文件类型判断
+func matchesFileKind(rule models.Rule, facts *FileFacts) bool {
+	passed, _ := fileKindCheck(rule, facts)
+	return passed
+}
+
+// fileKindCheck 按全部文件、扩展名或文件类型判断，并说明判断依据
+func fileKindCheck(rule models.Rule, facts *FileFacts) (bool, string) {
+	switch {
+	case rule.CatchAll:
+		return true, "兜底规则匹配所有文件"
+	case rule.AllowAllFiles:
+		return true, "allow_all_files 匹配所有文件"
+	case len(rule.FileTypes) == 0 && len(rule.CustomExtensions) == 0:
+		if hasConditions(rule.Conditions) || rule.ConditionTree != nil {
+			return true, "未限定文件类型与扩展名，只按条件判断"
+		}
+		return false, "未设置文件类型、扩展名或条件"
+	case facts.Ext != "" && matchExtension(facts.Ext, rule.CustomExtensions):
+		return true, fmt.Sprintf("扩展名 %q 在 custom_extensions 中", facts.Ext)
+	case facts.Type != "" && containsString(rule.FileTypes, facts.Type):
+		return true, fmt.Sprintf("类型 %q 在 file_types 中", facts.Type)
+	default:
+		return false, fmt.Sprintf("扩展名 %q、类型 %q 不在 custom_extensions %v 或 file_types %v 中",
+			facts.Ext, facts.Type, rule.CustomExtensions, rule.FileTypes)
+	}
+}
+
+// TemplateValues 命名模板与目标目录模板的占位符取值
+type TemplateValues struct {
+	OriginalName string    // 原文件名（含扩展名）
+	BaseName     string    // 不含扩展名的原文件名，为空时由 OriginalName 去掉扩展名得到
+	AIName       string    // AI 建议的文件名
+	AICategory   string    // AI 分类
+	FileType     string    // 文件类型，如 image、document
+	Time         time.Time // 按规则日期来源选取的时间
+}
+
+// BuildNameFromTemplate 按命名模板生成文件名（不含扩展名）。
+// 命名模板的各项是纯文本，只识别 nameTokenValue 中的占位符，其他内容原样保留
+func BuildNameFromTemplate(template []string, values TemplateValues) string {
 	parts := make([]string, 0, len(template))
-	originalBase := strings.TrimSuffix(originalName, filepath.Ext(originalName))
-	aiBase := sanitizeName(strings.TrimSuffix(aiName, filepath.Ext(aiName)))
 
 	for _, part := range template {
-		switch part {
-		case "YYYY":
-			parts = append(parts, t.Format("2006"))
-		case "MM":
-			parts = append(parts, t.Format("01"))
-		case "DD":
-			parts = append(parts, t.Format("02"))
-		case "HH":
-			parts = append(parts, t.Format("15"))
-		case "mm":
-			parts = append(parts, t.Format("04"))
-		case "original":
-			if aiBase != "" {
-				parts = append(parts, aiBase)
-			} else {
-				parts = append(parts, sanitizeName(originalBase))
-			}
-		default:
-			if strings.HasPrefix(part, "separator") {
-				separator := strings.TrimPrefix(part, "separator")
-				parts = append(parts, separator)
-			} else {
-				parts = append(parts, sanitizeName(part))
-			}
+		if value, ok := nameTokenValue(part, values); ok {
+			parts = append(parts, value)
+		} else if strings.HasPrefix(part, "separator") {
+			separator := strings.TrimPrefix(part, "separator")
+			parts = append(parts, separator)
+		} else {
+			parts = append(parts, sanitizeName(part))
 		}
 	}
 
 	return strings.Join(parts, "")
 }
 
+// nameTokenValue 解析命名模板占位符，不是占位符时返回 false
+func nameTokenValue(token string, values TemplateValues) (string, bool) {
+	t := values.Time
+	switch token {
+	case "YYYY":
+		return t.Format("2006"), true
+	case "MM":
+		return t.Format("01"), true
+	case "DD":
+		return t.Format("02"), true
+	case "HH":
+		return t.Format("15"), true
+	case "mm":
+		return t.Format("04"), true
+	case "original":
+		aiBase := sanitizeName(strings.TrimSuffix(values.AIName, filepath.Ext(values.AIName)))
+		if values.AIName != "" && aiBase != "" {
+			return aiBase, true
+		}
+		base := values.BaseName
+		if base == "" {
+			base = strings.TrimSuffix(values.OriginalName, filepath.Ext(values.OriginalName))
+		}
+		return sanitizeName(base), true
+	default:
+		return "", false
+	}
+}
+
+// templateTokenValue 解析目标目录模板占位符，不是占位符时返回 false。
+// 目标目录中的占位符写在 {} 内，不会与普通文字混淆，因此比命名模板多出 ai_category、ext、type
+func templateTokenValue(token string, values TemplateValues) (string, bool) {
+	if value, ok := nameTokenValue(token, values); ok {
+		return value, true
+	}
+	switch token {
+	case "ai_category":
+		if strings.TrimSpace(values.AICategory) == "" {
+			return "未分类", true
+		}
+		return sanitizeName(values.AICategory), true
+	case "ext":
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(values.OriginalName)), ".")
+		if ext == "" {
+			return "其他", true
+		}
+		return sanitizeName(ext), true
+	case "type":
+		if values.FileType == "" {
+			return "其他", true
+		}
+		return values.FileType, true
+	default:
+		return "", false
+	}
+}
+
 func SelectTimestamp(filePath string, dateSource string) time.Time {
 	info, err := os.Stat(filePath)
 	if err != nil {
@@ -87,11 +267,23 @@ func SelectTimestamp(filePath string, dateSource string) time.Time {
 	}
 }
 
+// detectFileType 文件分类，见 detectFileKind
 func detectFileType(filePath string, info os.FileInfo) string {
+	fileType, _ := detectFileKind(filePath, info)
+	return fileType
+}
+
+// detectFileKind 读取文件头识别 MIME 类型并据此分类，无法识别时按扩展名分类
+func detectFileKind(filePath string, info os.FileInfo) (fileType, mime string) {
 	if info.IsDir() {
-		return "folder"
+		return "folder", ""
 	}
+	mime = SniffMIME(filePath)
+	return combineFileType(mime, extensionFileType(filePath)), mime
+}
 
+// extensionFileType 按扩展名分类
+func extensionFileType(filePath string) string {
 	ext := strings.ToLower(filepath.Ext(filePath))
 	switch ext {
 	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".tiff", ".heic":
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"main/database"
+	"main/models"
+)
+
+func TestMergeRuleUpdate(t *testing.T) {
+	existing := models.Rule{
+		ID:             "rule_1",
+		Name:           "Invoices",
+		Action:         ActionMove,
+		ConflictPolicy: ConflictDedupe,
+		Conditions:     models.RuleConditions{NameGlob: "*invoice*", MinSize: 10},
+		ConditionTree:  &models.ConditionNode{Match: &models.RuleConditions{MaxSize: 100}},
+	}
+
+	cases := []struct {
+		name    string
+		body    string
+		check   func(rule models.Rule) bool
+		wantErr bool
+	}{
+		{
+			name: "omitted fields keep stored values",
+			body: `{"name": "Bills"}`,
+			check: func(rule models.Rule) bool {
+				return rule.Name == "Bills" && rule.ConflictPolicy == ConflictDedupe &&
+					rule.Conditions.NameGlob == "*invoice*" && rule.ConditionTree != nil
+			},
+		},
+		{
+			name: "objects are replaced as a whole",
+			body: `{"conditions": {"max_size": 5}}`,
+			check: func(rule models.Rule) bool {
+				return rule.Conditions.MaxSize == 5 && rule.Conditions.NameGlob == "" && rule.Conditions.MinSize == 0
+			},
+		},
+		{
+			name:  "null clears the condition tree",
+			body:  `{"condition_tree": null}`,
+			check: func(rule models.Rule) bool { return rule.ConditionTree == nil && rule.Name == "Invoices" },
+		},
+		{name: "array body", body: `[]`, wantErr: true},
+		{name: "null body", body: `null`, wantErr: true},
+		{name: "wrong field type", body: `{"name": 1}`, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := MergeRuleUpdate(existing, []byte(tc.body))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("MergeRuleUpdate(%s) succeeded, want error", tc.body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.check(rule) {
+				t.Fatalf("MergeRuleUpdate(%s) = %+v", tc.body, rule)
+			}
+		})
+	}
+}
+
+func TestReorderRules(t *testing.T) {
+	initTestDB(t)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		rule, err := database.CreateRule(models.Rule{
+			ID:               fmt.Sprintf("rule_%d", i),
+			Name:             fmt.Sprintf("Rule %d", i),
+			Action:           ActionCopy,
+			CustomExtensions: []string{".txt"},
+			Enabled:          true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, rule.ID)
+	}
+
+	cases := []struct {
+		name    string
+		order   []string
+		wantErr bool
+	}{
+		{name: "reversed", order: []string{ids[2], ids[1], ids[0]}},
+		{name: "duplicate", order: []string{ids[0], ids[0], ids[1], ids[2]}, wantErr: true},
+		{name: "unknown", order: []string{ids[0], ids[1], ids[2], "rule_missing"}, wantErr: true},
+		{name: "missing", order: []string{ids[0], ids[1]}, wantErr: true},
+		{name: "empty", order: nil, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := ruleIDs(t)
+			err := ReorderRules(tc.order)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidRuleOrder) {
+					t.Fatalf("ReorderRules error = %v, want ErrInvalidRuleOrder", err)
+				}
+				if after := ruleIDs(t); !reflect.DeepEqual(after, before) {
+					t.Fatalf("order changed by a rejected reorder: %v -> %v", before, after)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after := ruleIDs(t); !reflect.DeepEqual(after, tc.order) {
+				t.Fatalf("order = %v, want %v", after, tc.order)
+			}
+		})
+	}
+}
+
+// ruleIDs 按优先级排列的规则 ID
+func ruleIDs(t *testing.T) []string {
+	t.Helper()
+	rules, err := database.GetRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(rules))
+	for i, rule := range rules {
+		ids[i] = rule.ID
+	}
+	return ids
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"main/database"
+	"main/models"
+)
+
+// ErrInvalidRuleTest 规则测试的文件描述无效
+var ErrInvalidRuleTest = errors.New("规则测试请求无效")
+
+// ExplainRules 对已有文件或虚拟文件逐条判断规则，返回每项条件的结果、生效的规则以及预期的名称和目标位置。
+// 不调用 AI，也不修改文件系统
+func ExplainRules(req models.RuleTestRequest) (*models.RuleTestResult, error) {
+	var facts *FileFacts
+	var err error
+	switch {
+	case req.FilePath != "" && req.File != nil:
+		return nil, fmt.Errorf("%w: file_path 与 file 只能设置一个", ErrInvalidRuleTest)
+	case req.FilePath != "":
+		facts, err = CollectFileFacts(req.FilePath)
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+	case req.File != nil:
+		facts, err = syntheticFacts(*req.File)
+	default:
+		return nil, fmt.Errorf("%w: 需要 file_path 或 file", ErrInvalidRuleTest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := database.GetRules()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.RuleTestResult{
+		File: models.RuleTestFacts{
+			Path:     facts.Path,
+			Name:     facts.Name,
+			Dir:      facts.Dir,
+			Ext:      facts.Ext,
+			FileType: facts.Type,
+			MIMEType: facts.MIME,
+			Size:     facts.Size(),
+			AgeHours: facts.AgeHours(),
+			Hidden:   facts.Hidden,
+			IsDir:    facts.IsDir,
+		},
+		Rules:    make([]models.RuleEvaluation, 0, len(rules)),
+		RuleUsed: "默认规则",
+	}
+
+	var winner *models.Rule
+	for i := range rules {
+		evaluation := explainRule(rules[i], facts)
+		result.Rules = append(result.Rules, evaluation)
+		if evaluation.Matched && winner == nil {
+			winner = &rules[i]
+		}
+	}
+	if winner != nil {
+		result.RuleID = winner.ID
+		if winner.Name != "" {
+			result.RuleUsed = winner.Name
+		}
+	} else {
+		result.Notes = append(result.Notes, "没有匹配的规则，使用默认规则")
+	}
+
+	if err := previewRuleOutput(result, winner, facts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// syntheticFacts 由虚拟文件描述生成文件信息，类型按 MIME 类型与扩展名判断
+func syntheticFacts(file models.RuleTestFile) (*FileFacts, error) {
+	name := strings.TrimSpace(file.Name)
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("%w: file.name 必须是不含路径的文件名", ErrInvalidRuleTest)
+	}
+	dir := file.Dir
+	if dir == "" {
+		dir, _ = os.UserHomeDir()
+	}
+	dir = filepath.Clean(expandHome(dir))
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("%w: file.dir 必须是绝对路径或以 ~ 开头", ErrInvalidRuleTest)
+	}
+	if file.Size < 0 || file.AgeHours < 0 {
+		return nil, fmt.Errorf("%w: file.size 与 file.age_hours 不能为负数", ErrInvalidRuleTest)
+	}
+
+	now := time.Now()
+	mime := strings.ToLower(strings.TrimSpace(file.MIMEType))
+	facts := &FileFacts{
+		Path:      filepath.Join(dir, name),
+		Name:      name,
+		Dir:       dir,
+		Ext:       strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), "."),
+		MIME:      mime,
+		IsDir:     file.IsDir,
+		Hidden:    strings.HasPrefix(name, "."),
+		ModTime:   now.Add(-time.Duration(file.AgeHours * float64(time.Hour))),
+		Now:       now,
+		size:      file.Size,
+		sizeKnown: true,
+	}
+	if file.IsDir {
+		facts.Type = "folder"
+		facts.MIME = ""
+	} else {
+		facts.Type = combineFileType(mime, extensionFileType(name))
+	}
+	return facts, nil
+}
+
+// explainRule 判断单条规则，不短路，列出每项条件的结果
+func explainRule(rule models.Rule, facts *FileFacts) models.RuleEvaluation {
+	evaluation := models.RuleEvaluation{
+		RuleID:   rule.ID,
+		RuleName: rule.Name,
+		Priority: rule.Priority,
+		Enabled:  rule.Enabled,
+		CatchAll: rule.CatchAll,
+	}
+	if !rule.Enabled {
+		evaluation.Checks = append(evaluation.Checks, models.ConditionCheck{
+			Condition: "enabled",
+			Detail:    "规则已停用",
+		})
+	}
+
+	kindPassed, detail := fileKindCheck(rule, facts)
+	evaluation.Checks = append(evaluation.Checks, models.ConditionCheck{
+		Condition: "file_kind",
+		Passed:    kindPassed,
+		Detail:    detail,
+	})
+
+	conditionsPassed, checks := explainConditions("conditions", rule.Conditions, facts)
+	evaluation.Checks = append(evaluation.Checks, checks...)
+
+	treePassed := true
+	if rule.ConditionTree != nil {
+		treePassed, checks = explainConditionTree("condition_tree", *rule.ConditionTree, facts)
+		evaluation.Checks = append(evaluation.Checks, checks...)
+	}
+
+	evaluation.Matched = rule.Enabled && kindPassed && conditionsPassed && treePassed
+	return evaluation
+}
+
+// explainConditions 逐项判断附加条件
+func explainConditions(path string, conditions models.RuleConditions, facts *FileFacts) (bool, []models.ConditionCheck) {
+	passed := true
+	var checks []models.ConditionCheck
+	for _, check := range conditionChecks(conditions) {
+		ok, detail := check.eval(facts)
+		checks = append(checks, models.ConditionCheck{
+			Condition: path + "." + check.field,
+			Passed:    ok,
+			Detail:    detail,
+		})
+		passed = passed && ok
+	}
+	return passed, checks
+}
+
+// explainConditionTree 判断条件树，先列出子节点的结果，再列出分组节点自身的结果
+func explainConditionTree(path string, node models.ConditionNode, facts *FileFacts) (bool, []models.ConditionCheck) {
+	var checks []models.ConditionCheck
+	group := func(name string, children []models.ConditionNode, all bool) bool {
+		matched := 0
+		for i, child := range children {
+			ok, childChecks := explainConditionTree(fmt.Sprintf("%s.%s[%d]", path, name, i), child, facts)
+			checks = append(checks, childChecks...)
+			if ok {
+				matched++
+			}
+		}
+		passed := matched > 0
+		if all {
+			passed = matched == len(children)
+		}
+		checks = append(checks, models.ConditionCheck{
+			Condition: path + "." + name,
+			Passed:    passed,
+			Detail:    fmt.Sprintf("%d/%d 个子条件满足", matched, len(children)),
+		})
+		return passed
+	}
+
+	switch {
+	case node.All != nil:
+		return group("all", node.All, true), checks
+	case node.Any != nil:
+		return group("any", node.Any, false), checks
+	case node.Not != nil:
+		ok, childChecks := explainConditionTree(path+".not", *node.Not, facts)
+		checks = append(checks, childChecks...)
+		checks = append(checks, models.ConditionCheck{
+			Condition: path + ".not",
+			Passed:    !ok,
+			Detail:    fmt.Sprintf("子条件结果为 %v，取反", ok),
+		})
+		return !ok, checks
+	case node.Match != nil:
+		return explainConditions(path+".match", *node.Match, facts)
+	default:
+		return false, checks
+	}
+}
+
+// previewRuleOutput 按 PlanFile 的方式计算规则生效后的动作、名称与目标位置，不调用 AI、不处理冲突
+func previewRuleOutput(result *models.RuleTestResult, rule *models.Rule, facts *FileFacts) error {
+	action := ActionCopy
+	keepOriginal := false
+	conflictPolicy := ConflictRename
+	folderMode := FolderUnit
+	dateSource := "current"
+	destDir := defaultDestination()
+	var nameTemplate []string
+	archiveFormat := ArchiveZip
+
+	if rule != nil {
+		if rule.Action != "" {
+			action = rule.Action
+		}
+		if rule.Destination != "" {
+			destDir = rule.Destination
+		}
+		keepOriginal = rule.KeepOriginal
+		if rule.ConflictPolicy != "" {
+			conflictPolicy = rule.ConflictPolicy
+		}
+		if rule.FolderMode != "" {
+			folderMode = rule.FolderMode
+		}
+		if rule.DateSource != "" {
+			dateSource = rule.DateSource
+		}
+		nameTemplate = rule.NameTemplate
+		if rule.ArchiveFormat != "" {
+			archiveFormat = rule.ArchiveFormat
+		}
+		if len(rule.Steps) > 0 {
+			action = ActionPipeline
+		}
+		if rule.AIEnabled {
+			result.Notes = append(result.Notes, "规则启用了 AI 分析，预览未调用 AI，名称与 ai_category 按未分析时计算")
+		}
+	}
+	result.Action = effectiveAction(action, keepOriginal)
+
+	if facts.IsDir && folderMode == FolderExpand {
+		result.Destination = facts.Path
+		result.NewName = facts.Name
+		result.Notes = append(result.Notes, "文件夹将被展开，其中每个文件单独匹配规则")
+		return nil
+	}
+
+	ext := filepath.Ext(facts.Name)
+	if facts.IsDir {
+		ext = ""
+	}
+	baseName := strings.TrimSuffix(facts.Name, ext)
+	switch result.Action {
+	case ActionExtract:
+		baseName = trimArchiveExt(facts.Name)
+		ext = ""
+	case ActionCompress:
+		ext = "." + archiveFormat
+	}
+
+	timestamp := facts.Now
+	if dateSource == "created" || dateSource == "modified" {
+		timestamp = facts.ModTime
+	}
+	values := TemplateValues{
+		OriginalName: facts.Name,
+		BaseName:     baseName,
+		FileType:     facts.Type,
+		Time:         timestamp,
+	}
+	newBase := buildNewBase(nameTemplate, values)
+
+	if result.Action == ActionPipeline {
+		plan := &models.FilePlan{OriginalPath: facts.Path, ConflictPolicy: conflictPolicy}
+		if _, err := planPipeline(plan, rule.Steps, values, newBase, facts.IsDir); err != nil {
+			return err
+		}
+		result.Destination = plan.Destination
+		result.NewName = plan.NewName
+		return nil
+	}
+
+	destDir, err := ResolveDestination(destDir, values)
+	if err != nil {
+		return err
+	}
+	if result.Action == ActionInPlace {
+		destDir = facts.Dir
+	}
+	result.Destination = filepath.Join(destDir, newBase+ext)
+	result.NewName = newBase + ext
+
+	if result.Destination != filepath.Clean(facts.Path) {
+		if _, err := os.Lstat(result.Destination); err == nil {
+			result.Notes = append(result.Notes, fmt.Sprintf("目标位置已存在同名文件，实际处理时按冲突策略 %s 处理", conflictPolicy))
+		}
+	}
+	return nil
+}
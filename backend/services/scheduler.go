@@ -0,0 +1,412 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"main/database"
+	"main/models"
+)
+
+// HistoryActionSweep 定时整理汇总记录的操作类型
+const HistoryActionSweep = "sweep"
+
+// 定时整理的触发方式
+const (
+	ScheduleTriggerCron   = "schedule"
+	ScheduleTriggerManual = "manual"
+)
+
+const (
+	// scheduleTick 调度器检查到期任务的间隔
+	scheduleTick = 30 * time.Second
+	// sweepMinAge 最近仍在修改的文件可能尚未写完，留到下次整理
+	sweepMinAge = time.Minute
+)
+
+// ErrScheduleNotFound 定时整理不存在
+var ErrScheduleNotFound = errors.New("定时整理不存在")
+
+// ErrScheduleRunning 上一次执行尚未结束
+var ErrScheduleRunning = errors.New("定时整理正在执行")
+
+var runningSchedules = struct {
+	sync.Mutex
+	ids map[string]bool
+}{ids: make(map[string]bool)}
+
+// StartScheduler 启动定时整理调度器。服务未运行期间错过的执行不会补跑
+func StartScheduler() error {
+	if err := database.ResetInterruptedScheduleRuns(); err != nil {
+		return err
+	}
+
+	schedules, err := database.GetSchedules()
+	if err != nil {
+		return err
+	}
+	for _, schedule := range schedules {
+		if err := database.SetScheduleNextRun(schedule.ID, nextScheduleRun(schedule, time.Now())); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(scheduleTick)
+		defer ticker.Stop()
+		for range ticker.C {
+			runDueSchedules()
+		}
+	}()
+
+	log.Printf("⏰ Scheduler started: %d schedules", len(schedules))
+	return nil
+}
+
+// NormalizeSchedule 校验定时整理配置，整理路径并计算下次执行时间
+func NormalizeSchedule(schedule *models.Schedule) error {
+	if strings.TrimSpace(schedule.Path) == "" {
+		return errors.New("整理路径不能为空")
+	}
+	path, err := filepath.Abs(expandHome(strings.TrimSpace(schedule.Path)))
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("整理路径不可用: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("整理路径不是文件夹: %s", path)
+	}
+	schedule.Path = path
+
+	if strings.TrimSpace(schedule.Name) == "" {
+		schedule.Name = filepath.Base(path)
+	}
+
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return err
+	}
+	if cron.Next(time.Now()).IsZero() {
+		return fmt.Errorf("cron 表达式 %q 永远不会触发", schedule.Cron)
+	}
+
+	for _, ruleID := range schedule.RuleIDs {
+		if _, err := database.GetRule(ruleID); err != nil {
+			return fmt.Errorf("规则不存在: %s", ruleID)
+		}
+	}
+
+	schedule.NextRunAt = nextScheduleRun(*schedule, time.Now())
+	return nil
+}
+
+// RunScheduleNow 立即执行一次定时整理，整理在后台进行
+func RunScheduleNow(id string) (models.ScheduleRun, error) {
+	schedule, err := database.GetSchedule(id)
+	if err == sql.ErrNoRows {
+		return models.ScheduleRun{}, ErrScheduleNotFound
+	}
+	if err != nil {
+		return models.ScheduleRun{}, err
+	}
+	return startScheduleRun(schedule, ScheduleTriggerManual)
+}
+
+// nextScheduleRun 计算下次执行时间，未启用或表达式无效时为空
+func nextScheduleRun(schedule models.Schedule, from time.Time) string {
+	if !schedule.Enabled {
+		return ""
+	}
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return ""
+	}
+	next := cron.Next(from)
+	if next.IsZero() {
+		return ""
+	}
+	return next.Format(time.RFC3339)
+}
+
+// runDueSchedules 执行所有已到期的定时整理
+func runDueSchedules() {
+	schedules, err := database.GetSchedules()
+	if err != nil {
+		log.Printf("读取定时整理失败: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, schedule := range schedules {
+		if !schedule.Enabled || schedule.NextRunAt == "" {
+			continue
+		}
+		due, err := time.Parse(time.RFC3339, schedule.NextRunAt)
+		if err != nil || due.After(now) {
+			continue
+		}
+
+		if err := database.SetScheduleNextRun(schedule.ID, nextScheduleRun(schedule, now)); err != nil {
+			log.Printf("更新下次执行时间失败: %v", err)
+			continue
+		}
+		if _, err := startScheduleRun(schedule, ScheduleTriggerCron); err != nil {
+			log.Printf("定时整理 %s 未执行: %v", schedule.Name, err)
+		}
+	}
+}
+
+// startScheduleRun 创建执行记录并在后台整理，同一个定时整理不会并发执行
+func startScheduleRun(schedule models.Schedule, trigger string) (models.ScheduleRun, error) {
+	runningSchedules.Lock()
+	if runningSchedules.ids[schedule.ID] {
+		runningSchedules.Unlock()
+		return models.ScheduleRun{}, ErrScheduleRunning
+	}
+	runningSchedules.ids[schedule.ID] = true
+	runningSchedules.Unlock()
+
+	run, err := database.CreateScheduleRun(models.ScheduleRun{
+		ScheduleID: schedule.ID,
+		Trigger:    trigger,
+		Status:     "running",
+	})
+	if err != nil {
+		finishRunningSchedule(schedule.ID)
+		return models.ScheduleRun{}, err
+	}
+
+	go func() {
+		defer finishRunningSchedule(schedule.ID)
+		runSchedule(schedule, run)
+	}()
+	return run, nil
+}
+
+func finishRunningSchedule(id string) {
+	runningSchedules.Lock()
+	delete(runningSchedules.ids, id)
+	runningSchedules.Unlock()
+}
+
+// runSchedule 整理目录，并将汇总写入执行记录和历史记录
+func runSchedule(schedule models.Schedule, run models.ScheduleRun) {
+	started := time.Now()
+	log.Printf("开始定时整理: %s (%s)", schedule.Name, schedule.Path)
+
+	err := sweepDirectory(schedule, &run)
+	run.Status = "success"
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+		log.Printf("定时整理失败 %s: %v", schedule.Name, err)
+	}
+
+	summary := map[string]string{
+		"schedule_id": schedule.ID,
+		"run_id":      strconv.FormatInt(run.ID, 10),
+		"trigger":     run.Trigger,
+		"total":       strconv.Itoa(run.Total),
+		"succeeded":   strconv.Itoa(run.Succeeded),
+		"skipped":     strconv.Itoa(run.Skipped),
+		"failed":      strconv.Itoa(run.Failed),
+		"unmatched":   strconv.Itoa(run.Unmatched),
+		"duration_ms": strconv.FormatInt(time.Since(started).Milliseconds(), 10),
+	}
+	if run.Error != "" {
+		summary["error"] = run.Error
+	}
+	historyID, err := database.SaveHistory(models.HistoryRecord{
+		OriginalPath: schedule.Path,
+		OriginalName: schedule.Name,
+		NewPath:      schedule.Path,
+		NewName:      filepath.Base(schedule.Path),
+		RuleName:     schedule.Name,
+		Action:       HistoryActionSweep,
+		Status:       run.Status,
+		Metadata:     summary,
+	})
+	if err != nil {
+		log.Printf("保存整理汇总失败: %v", err)
+	}
+	run.HistoryID = historyID
+
+	finishedAt := time.Now().Format(time.RFC3339)
+	run.FinishedAt = finishedAt
+	if err := database.FinishScheduleRun(run); err != nil {
+		log.Printf("保存执行记录失败: %v", err)
+	}
+	if err := database.SetScheduleLastRun(schedule.ID, finishedAt); err != nil {
+		log.Printf("更新执行时间失败: %v", err)
+	}
+
+	log.Printf("定时整理完成: %s，共 %d 个文件，成功 %d，跳过 %d，失败 %d，未匹配 %d",
+		schedule.Name, run.Total, run.Succeeded, run.Skipped, run.Failed, run.Unmatched)
+}
+
+// sweepDirectory 逐个文件匹配规则并处理，没有匹配到规则的文件保持原样
+func sweepDirectory(schedule models.Schedule, run *models.ScheduleRun) error {
+	rules, err := scheduleRules(schedule)
+	if err != nil {
+		return err
+	}
+
+	files, err := listSweepFiles(schedule, rules)
+	if err != nil {
+		return fmt.Errorf("读取目录失败: %v", err)
+	}
+	for _, file := range files {
+		rule := MatchRuleForFile(file, rules)
+		// 目标目录就是整理目录本身时，已整理的文件仍会被列出，再次处理会重新命名（如再加一次日期前缀）
+		if rule != nil && inRuleDestination(file, *rule) {
+			continue
+		}
+		run.Total++
+		if rule == nil {
+			run.Unmatched++
+			continue
+		}
+
+		ctx := WithEventScope(context.Background(), "", "", file)
+		response, err := ProcessFile(ctx, models.FileProcessRequest{
+			FilePath: file,
+			UseAI:    schedule.UseAI,
+			Model:    schedule.Model,
+			RuleID:   rule.ID,
+		})
+		switch {
+		case err != nil:
+			run.Failed++
+			log.Printf("整理文件失败 %s: %v", file, err)
+		case response.Status == "skipped":
+			run.Skipped++
+		case response.Status == "partial":
+			run.Failed++
+			log.Printf("整理文件部分步骤失败 %s: %s", file, response.Error)
+		default:
+			run.Succeeded++
+		}
+	}
+	return nil
+}
+
+// scheduleRules 返回参与匹配的规则，保持规则列表原有的顺序
+func scheduleRules(schedule models.Schedule) ([]models.Rule, error) {
+	rules, err := database.GetRules()
+	if err != nil {
+		return nil, fmt.Errorf("获取规则失败: %v", err)
+	}
+	if len(schedule.RuleIDs) == 0 {
+		return rules, nil
+	}
+
+	selected := make([]models.Rule, 0, len(schedule.RuleIDs))
+	for _, rule := range rules {
+		if containsString(schedule.RuleIDs, rule.ID) {
+			selected = append(selected, rule)
+		}
+	}
+	return selected, nil
+}
+
+// listSweepFiles 列出需要整理的文件：跳过隐藏文件、临时文件、最近仍在修改的文件，
+// 以及位于整理目录下的规则目标目录内（已整理过）的文件
+func listSweepFiles(schedule models.Schedule, rules []models.Rule) ([]string, error) {
+	var destinations []string
+	for _, rule := range rules {
+		if rule.Destination == "" {
+			continue
+		}
+		destination := filepath.Clean(DestinationBase(rule.Destination))
+		if destination != schedule.Path && isWithinAny(destination, []string{schedule.Path}) {
+			destinations = append(destinations, destination)
+		}
+	}
+
+	cutoff := time.Now().Add(-sweepMinAge)
+	var files []string
+	err := filepath.WalkDir(schedule.Path, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if path == schedule.Path {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") || isWithinAny(path, destinations) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if !schedule.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || isIgnoredWatchFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	return files, err
+}
+
+// inRuleDestination 判断文件是否已位于规则为它计算出的目标目录中。
+// 原地重命名的目标目录总是文件所在目录，改为判断文件是否就是该规则之前处理的结果；
+// 流水线没有单一的目标目录，交给生成计划时的冲突处理判断
+func inRuleDestination(filePath string, rule models.Rule) bool {
+	if rule.Action == ActionInPlace {
+		organized, err := database.IsRuleOutput(filePath, rule.ID)
+		if err != nil {
+			log.Printf("查询历史记录失败: %v", err)
+		}
+		return organized
+	}
+	if len(rule.Steps) > 0 {
+		return false
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false
+	}
+
+	destination := rule.Destination
+	if destination == "" {
+		destination = defaultDestination()
+	}
+	destDir, err := ResolveDestination(destination, TemplateValues{
+		OriginalName: filepath.Base(filePath),
+		FileType:     detectFileType(filePath, info),
+		Time:         SelectTimestamp(filePath, rule.DateSource),
+	})
+	return err == nil && filepath.Clean(destDir) == filepath.Dir(filePath)
+}
+
+// isWithinAny 判断路径是否位于任一目录之内
+func isWithinAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
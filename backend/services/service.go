@@ -3,7 +3,9 @@ package services
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,80 +17,193 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"main/models"
 )
 
-// GlobalAIConfig 全局 AI 配置
-var GlobalAIConfig = models.AIConfig{
-	Provider: "ollama",
-	BaseURL:  "http://localhost:11434",
-	Model:    "qwen3-vl:4b",
+// globalAIConfig 全局 AI 配置，通过 CurrentAIConfig 读取、ReconfigureAI 修改
+var (
+	aiConfigMu     sync.RWMutex
+	globalAIConfig = models.AIConfig{
+		Provider: "ollama",
+		BaseURL:  "http://localhost:11434",
+		Model:    "qwen3-vl:4b",
+	}
+)
+
+// CurrentAIConfig 当前 AI 配置的副本
+func CurrentAIConfig() models.AIConfig {
+	aiConfigMu.RLock()
+	defer aiConfigMu.RUnlock()
+	return globalAIConfig
 }
 
 // UserTemplates 用户模板存储
 var UserTemplates = make(map[string]models.Template)
 
+// ProgressFunc 复制进度回调（已写入字节数，总字节数）
+type ProgressFunc func(written, total int64)
+
+// progressReader 在读取时回调复制进度
+type progressReader struct {
+	reader   io.Reader
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 && r.progress != nil {
+		r.written += int64(n)
+		r.progress(r.written, r.total)
+	}
+	return n, err
+}
+
+// ErrVerifyFailed 复制后校验失败（源文件与目标文件哈希不一致）
+var ErrVerifyFailed = errors.New("复制校验失败")
+
 // CopyFile 复制文件
 func CopyFile(src, dst string) error {
+	return CopyFileWithProgress(src, dst, nil)
+}
+
+// CopyFileWithProgress 复制文件并回调进度。
+// 先写入目标目录中的临时文件并 fsync，校验源与目标的 SHA-256 一致后再重命名到位，
+// 中途失败或崩溃不会留下不完整的目标文件
+func CopyFileWithProgress(src, dst string, progress ProgressFunc) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer sourceFile.Close()
 
-	destFile, err := os.Create(dst)
+	sourceInfo, err := sourceFile.Stat()
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
 
-	_, err = io.Copy(destFile, sourceFile)
+	tmpFile, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
 	if err != nil {
 		return err
 	}
+	tmpPath := tmpFile.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			tmpFile.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	// 读取源文件的同时计算哈希
+	sourceHasher := sha256.New()
+	var reader io.Reader = io.TeeReader(sourceFile, sourceHasher)
+	if progress != nil {
+		reader = &progressReader{reader: reader, total: sourceInfo.Size(), progress: progress}
+	}
+
+	if _, err := io.Copy(tmpFile, reader); err != nil {
+		return err
+	}
 
 	// 复制文件权限
-	sourceInfo, err := os.Stat(src)
+	if err := tmpFile.Chmod(sourceInfo.Mode()); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	// 从磁盘重新读取临时文件进行校验
+	destHash, err := HashFile(tmpPath)
 	if err != nil {
 		return err
 	}
-	return os.Chmod(dst, sourceInfo.Mode())
+	if sourceHash := hex.EncodeToString(sourceHasher.Sum(nil)); sourceHash != destHash {
+		return fmt.Errorf("%w: %s", ErrVerifyFailed, dst)
+	}
+
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return err
+	}
+	committed = true
+
+	syncDir(filepath.Dir(dst))
+	return nil
+}
+
+// syncDir 同步目录项，确保重命名在崩溃后仍然生效（不支持的平台忽略错误）
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	d.Sync()
 }
 
 // MoveFile 移动文件（跨设备时回退为复制删除）
 func MoveFile(src, dst string) error {
+	return MoveFileWithProgress(src, dst, nil)
+}
+
+// MoveFileWithProgress 移动文件，跨设备回退为复制时回调进度。
+// 复制校验通过后才会删除源文件
+func MoveFileWithProgress(src, dst string, progress ProgressFunc) error {
 	if err := os.Rename(src, dst); err == nil {
 		return nil
 	}
 
-	if err := CopyFile(src, dst); err != nil {
+	if err := CopyFileWithProgress(src, dst, progress); err != nil {
 		return err
 	}
 
 	return os.Remove(src)
 }
 
-// AnalyzeFile 使用配置的 AI 提供商分析文件
-func AnalyzeFile(filePath string, model string) (*models.AIAnalysis, error) {
-	if model == "" {
-		model = GlobalAIConfig.Model
+// HashFile 计算文件的 SHA-256（十六进制）
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
 	}
+	defer file.Close()
 
-	switch GlobalAIConfig.Provider {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// AnalyzeFile 使用配置的 AI 提供商分析文件。
+// 同一提供商的并发数受 max_concurrency 限制，超出时排队；同一文件的重复请求共享一次调用
+func AnalyzeFile(ctx context.Context, filePath string, model string) (*models.AIAnalysis, error) {
+	return aiQueue.analyze(ctx, filePath, model)
+}
+
+// analyzeFile 直接调用提供商分析文件，不经过并发限制
+func analyzeFile(ctx context.Context, config models.AIConfig, filePath, model string) (*models.AIAnalysis, error) {
+	switch config.Provider {
 	case "ollama":
-		return analyzeWithOllama(filePath, model)
+		return analyzeWithOllama(ctx, config, filePath, model)
 	case "openai", "deepseek", "qwen":
-		return analyzeWithOpenAICompatible(filePath, model)
+		return analyzeWithOpenAICompatible(ctx, config, filePath, model)
 	default:
-		return nil, fmt.Errorf("不支持的 AI 提供商: %s", GlobalAIConfig.Provider)
+		return nil, fmt.Errorf("不支持的 AI 提供商: %s", config.Provider)
 	}
 }
 
 // AnalyzeFileWithOllama 使用 Ollama API 分析文件（向后兼容）
 func AnalyzeFileWithOllama(filePath string, model string) (*models.AIAnalysis, error) {
-	return analyzeWithOllama(filePath, model)
+	return analyzeWithOllama(context.Background(), CurrentAIConfig(), filePath, model)
 }
 
 // isImageFile 判断是否为图片文件
@@ -108,27 +223,35 @@ func isPDFFile(ext string) bool {
 	return strings.ToLower(ext) == ".pdf"
 }
 
-// convertPDFToImage 将 PDF 第一页转为图片（使用 macOS qlmanage）
-func convertPDFToImage(pdfPath string) (string, error) {
-	// 创建临时目录
-	tmpDir := os.TempDir()
+// convertPDFToImage 将 PDF 第一页转为图片（使用 macOS qlmanage）。
+// 图片写入单独的临时目录，调用方处理完后需调用 cleanup 删除；ctx 取消时会终止转换进程
+func convertPDFToImage(ctx context.Context, pdfPath string) (imagePath string, cleanup func(), err error) {
+	tmpDir, err := os.MkdirTemp("", "blackhole-pdf-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	cleanup = func() { os.RemoveAll(tmpDir) }
 
 	// 使用 macOS Quick Look 生成缩略图
-	cmd := exec.Command("qlmanage", "-t", "-s", "1200", "-o", tmpDir, pdfPath)
+	cmd := exec.CommandContext(ctx, "qlmanage", "-t", "-s", "1200", "-o", tmpDir, pdfPath)
 	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("PDF转图片失败: %v", err)
+		cleanup()
+		if ctx.Err() != nil {
+			return "", nil, cancelledError(ctx)
+		}
+		return "", nil, fmt.Errorf("PDF转图片失败: %v", err)
 	}
 
 	// qlmanage 会生成 filename.pdf.png
-	pdfName := filepath.Base(pdfPath)
-	imagePath := filepath.Join(tmpDir, pdfName+".png")
+	imagePath = filepath.Join(tmpDir, filepath.Base(pdfPath)+".png")
 
 	// 检查文件是否存在
 	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
-		return "", fmt.Errorf("生成的图片不存在: %s", imagePath)
+		cleanup()
+		return "", nil, fmt.Errorf("生成的图片不存在: %s", imagePath)
 	}
 
-	return imagePath, nil
+	return imagePath, cleanup, nil
 }
 
 // encodeImageToBase64 将图片编码为 base64
@@ -141,9 +264,9 @@ func encodeImageToBase64(filePath string) (string, error) {
 }
 
 // analyzeWithOllama 使用 Ollama API 分析文件
-func analyzeWithOllama(filePath string, model string) (*models.AIAnalysis, error) {
+func analyzeWithOllama(ctx context.Context, config models.AIConfig, filePath string, model string) (*models.AIAnalysis, error) {
 	if model == "" {
-		model = GlobalAIConfig.Model
+		model = config.Model
 	}
 
 	fileName := filepath.Base(filePath)
@@ -170,7 +293,11 @@ func analyzeWithOllama(filePath string, model string) (*models.AIAnalysis, error
 	} else if isPDF {
 		// PDF 转图片
 		log.Printf("[AI] 正在将 PDF 转换为图片...")
-		convertedPath, err := convertPDFToImage(filePath)
+		emitStage(ctx, StageConverting, "正在将 PDF 转换为图片")
+		convertedPath, cleanup, err := convertPDFToImage(ctx, filePath)
+		if errors.Is(err, ErrCancelled) {
+			return nil, err
+		}
 		if err != nil {
 			log.Printf("[AI] PDF转图片失败: %v, 使用原名", err)
 			return &models.AIAnalysis{
@@ -180,7 +307,7 @@ func analyzeWithOllama(filePath string, model string) (*models.AIAnalysis, error
 			}, nil
 		}
 		imagePath = convertedPath
-		defer os.Remove(imagePath) // 处理完删除临时图片
+		defer cleanup() // 处理完删除临时图片
 		log.Printf("[AI] PDF 已转换为图片: %s", imagePath)
 	}
 
@@ -256,7 +383,7 @@ func analyzeWithOllama(filePath string, model string) (*models.AIAnalysis, error
 	debugJSON, _ := json.MarshalIndent(debugReqBody, "", "  ")
 	log.Printf("[AI] 发送请求到 %s: %s", apiEndpoint, string(debugJSON))
 
-	baseURL := GlobalAIConfig.BaseURL
+	baseURL := config.BaseURL
 	if baseURL == "" {
 		baseURL = "http://localhost:11434"
 	}
@@ -265,9 +392,19 @@ func analyzeWithOllama(filePath string, model string) (*models.AIAnalysis, error
 	if canUseVision {
 		requestTimeout = 180 * time.Second
 	}
-	client := &http.Client{Timeout: requestTimeout}
-	resp, err := client.Post(baseURL+apiEndpoint, "application/json", bytes.NewBuffer(jsonData))
+	emitStage(ctx, StageWaitModel, "等待模型 "+actualModel+" 响应")
+	requestCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(requestCtx, "POST", baseURL+apiEndpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, cancelledError(ctx)
+		}
 		if errors.Is(err, context.DeadlineExceeded) {
 			return nil, fmt.Errorf("Ollama 响应超时: %v", err)
 		}
@@ -355,9 +492,9 @@ func analyzeWithOllama(filePath string, model string) (*models.AIAnalysis, error
 }
 
 // analyzeWithOpenAICompatible 使用 OpenAI 兼容 API 分析文件
-func analyzeWithOpenAICompatible(filePath string, model string) (*models.AIAnalysis, error) {
+func analyzeWithOpenAICompatible(ctx context.Context, config models.AIConfig, filePath string, model string) (*models.AIAnalysis, error) {
 	if model == "" {
-		model = GlobalAIConfig.Model
+		model = config.Model
 	}
 
 	fileName := filepath.Base(filePath)
@@ -390,9 +527,9 @@ func analyzeWithOpenAICompatible(filePath string, model string) (*models.AIAnaly
 	jsonData, _ := json.Marshal(reqBody)
 
 	// 获取 base URL
-	baseURL := GlobalAIConfig.BaseURL
+	baseURL := config.BaseURL
 	if baseURL == "" {
-		switch GlobalAIConfig.Provider {
+		switch config.Provider {
 		case "openai":
 			baseURL = "https://api.openai.com/v1"
 		case "deepseek":
@@ -403,26 +540,31 @@ func analyzeWithOpenAICompatible(filePath string, model string) (*models.AIAnaly
 	}
 
 	// 创建请求
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("POST", baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	requestCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(requestCtx, "POST", baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if GlobalAIConfig.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+GlobalAIConfig.APIKey)
+	if config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+config.APIKey)
 	}
 
-	resp, err := client.Do(req)
+	emitStage(ctx, StageWaitModel, "等待模型 "+model+" 响应")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("无法连接到 %s: %v", GlobalAIConfig.Provider, err)
+		if ctx.Err() != nil {
+			return nil, cancelledError(ctx)
+		}
+		return nil, fmt.Errorf("无法连接到 %s: %v", config.Provider, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("%s API 返回错误 (状态码 %d): %s", GlobalAIConfig.Provider, resp.StatusCode, string(body))
+		return nil, fmt.Errorf("%s API 返回错误 (状态码 %d): %s", config.Provider, resp.StatusCode, string(body))
 	}
 
 	// 解析响应
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffLen 识别文件类型时读取的头部字节数（tar 的 ustar 标记位于 257 字节处）
+const sniffLen = 512
+
+// magicSignature 文件头特征
+type magicSignature struct {
+	offset int
+	magic  string
+	mime   string
+	// verify 不为空时表示特征过短，普通文本也可能以其开头：只在扩展名分类为空或与之一致时使用，
+	// 并由 verify 进一步校验文件结构
+	verify func(file io.ReaderAt, header []byte) bool
+}
+
+// magicSignatures 优先于 http.DetectContentType 检查的特征，补充其不识别或识别得不够具体的格式
+var magicSignatures = []magicSignature{
+	{0, "7z\xBC\xAF\x27\x1C", "application/x-7z-compressed", nil},
+	{0, "\xFD7zXZ\x00", "application/x-xz", nil},
+	{0, "BZh", "application/x-bzip2", isBzip2},
+	{257, "ustar", "application/x-tar", nil},
+	{0, "fLaC", "audio/flac", nil},
+	{0, "OggS", "audio/ogg", nil},
+	{0, "II*\x00", "image/tiff", nil},
+	{0, "MM\x00*", "image/tiff", nil},
+	{0, "8BPS", "image/vnd.adobe.photoshop", nil},
+	{0, "{\\rtf", "application/rtf", nil},
+	{0, "MZ", "application/vnd.microsoft.portable-executable", isPortableExecutable},
+	{0, "xar!", "application/x-xar", nil},
+	{60, "BOOKMOBI", "application/x-mobipocket-ebook", nil},
+}
+
+// isBzip2 "BZh" 之后应为块大小 1-9，接着是数据块或流结束标记
+func isBzip2(_ io.ReaderAt, header []byte) bool {
+	if len(header) < 10 || header[3] < '1' || header[3] > '9' {
+		return false
+	}
+	block := string(header[4:10])
+	return block == "\x31\x41\x59\x26\x53\x59" || block == "\x17\x72\x45\x38\x50\x90"
+}
+
+// isPortableExecutable "MZ" 文件头 0x3C 处记录的偏移位置应为 "PE\0\0"
+func isPortableExecutable(file io.ReaderAt, header []byte) bool {
+	if len(header) < 0x40 {
+		return false
+	}
+	offset := int64(binary.LittleEndian.Uint32(header[0x3C:0x40]))
+	if offset < 0x40 || offset > 1<<20 {
+		return false
+	}
+	signature := make([]byte, 4)
+	if _, err := file.ReadAt(signature, offset); err != nil {
+		return false
+	}
+	return string(signature) == "PE\x00\x00"
+}
+
+// zipMIMETypes 基于 zip 的 Office 文档按其中的目录区分
+var zipMIMETypes = []struct {
+	prefix string
+	mime   string
+}{
+	{"word/", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	{"xl/", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{"ppt/", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+}
+
+// SniffMIME 读取文件头识别 MIME 类型，无法读取或无法识别时返回空字符串
+func SniffMIME(filePath string) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	header = header[:n]
+
+	extType := extensionFileType(filePath)
+	for _, sig := range magicSignatures {
+		end := sig.offset + len(sig.magic)
+		if len(header) < end || string(header[sig.offset:end]) != sig.magic {
+			continue
+		}
+		if sig.verify != nil {
+			if extType != "" && extType != mimeFileType(sig.mime) {
+				continue
+			}
+			if !sig.verify(file, header) {
+				continue
+			}
+		}
+		return sig.mime
+	}
+	if mime := sniffISOBaseMedia(header); mime != "" {
+		return mime
+	}
+	if mime := sniffMatroska(header); mime != "" {
+		return mime
+	}
+
+	mime := http.DetectContentType(header)
+	if i := strings.Index(mime, ";"); i >= 0 {
+		mime = mime[:i]
+	}
+	switch mime {
+	case "application/zip":
+		return sniffZip(filePath)
+	case "application/octet-stream":
+		return ""
+	case "application/ogg":
+		return "audio/ogg"
+	case "video/avi":
+		return "video/x-msvideo"
+	}
+	return mime
+}
+
+// sniffISOBaseMedia 识别 ftyp 容器：MP4、MOV、M4A、HEIC 等
+func sniffISOBaseMedia(header []byte) string {
+	if len(header) < 12 || string(header[4:8]) != "ftyp" {
+		return ""
+	}
+	switch brand := string(header[8:12]); brand {
+	case "heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1":
+		return "image/heic"
+	case "avif", "avis":
+		return "image/avif"
+	case "qt  ":
+		return "video/quicktime"
+	case "M4A ", "M4B ":
+		return "audio/mp4"
+	default:
+		return "video/mp4"
+	}
+}
+
+// sniffMatroska 识别 EBML 容器，DocType 为 webm 时返回 video/webm
+func sniffMatroska(header []byte) string {
+	if !bytes.HasPrefix(header, []byte("\x1A\x45\xDF\xA3")) {
+		return ""
+	}
+	if bytes.Contains(header, []byte("webm")) {
+		return "video/webm"
+	}
+	return "video/x-matroska"
+}
+
+// sniffZip 查看 zip 中的条目，区分 Office 文档、EPUB 与普通压缩包
+func sniffZip(filePath string) string {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "application/zip"
+	}
+	defer reader.Close()
+
+	for _, entry := range reader.File {
+		if entry.Name == "mimetype" {
+			if rc, err := entry.Open(); err == nil {
+				data, _ := io.ReadAll(io.LimitReader(rc, 128))
+				rc.Close()
+				if mime := strings.TrimSpace(string(data)); mime != "" {
+					return mime
+				}
+			}
+		}
+		for _, office := range zipMIMETypes {
+			if strings.HasPrefix(entry.Name, office.prefix) {
+				return office.mime
+			}
+		}
+	}
+	return "application/zip"
+}
+
+// mimeFileType 将 MIME 类型归入 detectFileType 的分类，无法归类时返回空字符串
+func mimeFileType(mime string) string {
+	switch {
+	case mime == "":
+		return ""
+	case mime == "image/vnd.adobe.photoshop":
+		return "design"
+	case strings.HasPrefix(mime, "image/"):
+		return "image"
+	case strings.HasPrefix(mime, "video/"):
+		return "video"
+	case strings.HasPrefix(mime, "audio/"):
+		return "audio"
+	}
+
+	switch mime {
+	case "application/pdf", "application/rtf", "application/msword",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"application/vnd.oasis.opendocument.text",
+		"application/vnd.oasis.opendocument.spreadsheet",
+		"application/vnd.oasis.opendocument.presentation":
+		return "document"
+	case "application/zip", "application/x-gzip", "application/x-tar", "application/x-rar-compressed",
+		"application/x-7z-compressed", "application/x-xz", "application/x-bzip2":
+		return "archive"
+	case "application/epub+zip", "application/x-mobipocket-ebook":
+		return "ebook"
+	case "application/vnd.microsoft.portable-executable", "application/x-xar":
+		return "installer"
+	}
+	return ""
+}
+
+// containerExtensionTypes 某些格式以通用容器存储（.sketch 是 zip，.ai 是 PDF），
+// 扩展名分类在这些情况下比内容识别更准确
+var containerExtensionTypes = map[string][]string{
+	"application/zip": {"design", "ebook", "document", "installer"},
+	"application/pdf": {"design"},
+}
+
+// combineFileType 内容识别的分类优先，无法识别或属于通用容器时使用扩展名分类
+func combineFileType(mime, extType string) string {
+	sniffed := mimeFileType(mime)
+	if sniffed == "" {
+		return extType
+	}
+	if extType != "" && containsString(containerExtensionTypes[mime], extType) {
+		return extType
+	}
+	return sniffed
+}
+
+// matchMIMEType 匹配 MIME 类型，支持 image/* 形式的通配
+func matchMIMEType(mime string, patterns []string) bool {
+	if mime == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if strings.HasSuffix(pattern, "/*") {
+			if strings.HasPrefix(mime, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if pattern == mime {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPE 最小的 PE 文件头："MZ"，0x3C 处的偏移指向 "PE\0\0"
+func testPE() string {
+	header := make([]byte, 0x80)
+	copy(header, "MZ")
+	binary.LittleEndian.PutUint32(header[0x3C:], 0x40)
+	copy(header[0x40:], "PE\x00\x00")
+	return string(header)
+}
+
+// testBzip2 bzip2 流头：块大小 9 与第一个数据块的标记
+const testBzip2 = "BZh9\x31\x41\x59\x26\x53\x59\x00\x01\x02\x03\xff\xfe"
+
+// writeTestZip 写入只包含给定条目的 zip
+func writeTestZip(t *testing.T, path string, names ...string) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSniffMIME(t *testing.T) {
+	cases := []struct {
+		name     string
+		file     string
+		content  string // write 为空时写入的内容
+		write    func(t *testing.T, path string)
+		wantMIME string
+		wantType string
+	}{
+		{name: "png with a wrong extension", file: "photo.dat", content: "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 32),
+			wantMIME: "image/png", wantType: "image"},
+		{name: "pdf without an extension", file: "download", content: "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n",
+			wantMIME: "application/pdf", wantType: "document"},
+		{name: "mp4", file: "clip", content: "\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2",
+			wantMIME: "video/mp4", wantType: "video"},
+		{name: "empty file keeps the extension type", file: "empty.md", content: "", wantMIME: "", wantType: "document"},
+
+		{name: "portable executable", file: "setup", content: testPE(),
+			wantMIME: "application/vnd.microsoft.portable-executable", wantType: "installer"},
+		{name: "portable executable named .exe", file: "setup.exe", content: testPE(),
+			wantMIME: "application/vnd.microsoft.portable-executable", wantType: "installer"},
+		{name: "text starting with MZ", file: "notes", content: "MZebra crossing notes\n",
+			wantMIME: "text/plain", wantType: ""},
+		{name: "MZ header without a PE signature", file: "blob", content: "MZ" + strings.Repeat("\x00", 0x80),
+			wantMIME: "", wantType: ""},
+		{name: "PE bytes in a .txt file", file: "readme.txt", content: testPE(),
+			wantMIME: "", wantType: "document"},
+
+		{name: "bzip2", file: "data", content: testBzip2, wantMIME: "application/x-bzip2", wantType: "archive"},
+		{name: "bzip2 named .bz2", file: "data.bz2", content: testBzip2, wantMIME: "application/x-bzip2", wantType: "archive"},
+		{name: "text starting with BZh", file: "memo", content: "BZh is how bzip2 streams begin\n",
+			wantMIME: "text/plain", wantType: ""},
+		{name: "bzip2 bytes in a .md file", file: "memo.md", content: testBzip2, wantType: "document"},
+
+		{name: "tar", file: "bundle", write: func(t *testing.T, path string) {
+			writeTestTar(t, path, []testTarEntry{{name: "a.txt"}})
+		}, wantMIME: "application/x-tar", wantType: "archive"},
+		{name: "docx without an extension", file: "report", write: func(t *testing.T, path string) {
+			writeTestZip(t, path, "[Content_Types].xml", "word/document.xml")
+		}, wantMIME: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", wantType: "document"},
+		{name: "zip-based design file keeps the extension type", file: "mockup.sketch", write: func(t *testing.T, path string) {
+			writeTestZip(t, path, "document.json")
+		}, wantMIME: "application/zip", wantType: "design"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			if tc.write != nil {
+				tc.write(t, path)
+			} else {
+				writeTestFile(t, path, tc.content)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fileType, mime := detectFileKind(path, info)
+			if mime != tc.wantMIME || fileType != tc.wantType {
+				t.Fatalf("detectFileKind = %q, %q, want %q, %q", fileType, mime, tc.wantType, tc.wantMIME)
+			}
+		})
+	}
+}
+
+func TestMatchMIMEType(t *testing.T) {
+	cases := []struct {
+		mime     string
+		patterns []string
+		want     bool
+	}{
+		{"image/png", []string{"image/png"}, true},
+		{"image/png", []string{" Image/* "}, true},
+		{"image/png", []string{"video/*", "application/pdf"}, false},
+		{"application/pdf", []string{"application/pdf"}, true},
+		{"imagex/png", []string{"image/*"}, false},
+		{"", []string{"*/*"}, false},
+	}
+
+	for _, tc := range cases {
+		if got := matchMIMEType(tc.mime, tc.patterns); got != tc.want {
+			t.Errorf("matchMIMEType(%q, %q) = %v, want %v", tc.mime, tc.patterns, got, tc.want)
+		}
+	}
+}
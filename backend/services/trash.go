@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrTrashFailed 源文件已复制到目标，但放入回收站失败（源文件保持原样）
+var ErrTrashFailed = errors.New("放入回收站失败")
+
+// MovePathToTrash 移动文件或文件夹。同设备时直接重命名；跨设备回退为复制时，
+// 源文件放入回收站而不是直接删除，返回其在回收站中的路径
+func MovePathToTrash(src, dst string, progress ProgressFunc) (string, error) {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return "", err
+	}
+	// 目录只在目标不存在时重命名，避免覆盖策略下把源目录移入已有目录
+	if _, err := os.Lstat(dst); !info.IsDir() || os.IsNotExist(err) {
+		if err := os.Rename(src, dst); err == nil {
+			return "", nil
+		}
+	}
+
+	if err := CopyPath(src, dst, progress); err != nil {
+		return "", err
+	}
+
+	trashPath, err := MoveToTrash(src)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTrashFailed, err)
+	}
+	return trashPath, nil
+}
+
+// MoveToTrash 将文件或文件夹放入系统回收站，返回其在回收站中的路径
+func MoveToTrash(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return "", err
+	}
+	return moveToTrash(path)
+}
+
+// RestoreFromTrash 将回收站中的文件还原到原路径
+func RestoreFromTrash(trashPath, originalPath string) error {
+	if _, err := os.Lstat(trashPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("回收站中的文件已不存在: %s", trashPath)
+		}
+		return err
+	}
+	if _, err := os.Lstat(originalPath); err == nil {
+		return fmt.Errorf("原路径已存在文件 %s", originalPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(originalPath), 0755); err != nil {
+		return err
+	}
+
+	if err := MovePath(trashPath, originalPath, nil); err != nil {
+		return err
+	}
+	removeTrashInfo(trashPath)
+	return nil
+}
+
+// uniqueTrashName 在回收站目录中为文件选择未被占用的名称
+func uniqueTrashName(dir, name string, taken func(string) bool) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; i < 10000; i++ {
+		if !taken(candidate) {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s %d%s", base, i, ext)
+	}
+	return "", fmt.Errorf("无法在 %s 中为 %s 生成不冲突的名称", dir, name)
+}
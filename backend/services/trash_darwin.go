@@ -0,0 +1,46 @@
+//go:build darwin
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// moveToTrash 放入 macOS 回收站：主目录所在卷使用 ~/.Trash，其他卷使用该卷的 .Trashes/$uid
+func moveToTrash(path string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	trashDir := filepath.Join(homeDir, ".Trash")
+	if !sameDevice(path, homeDir) {
+		volume, err := mountPoint(path)
+		if err != nil {
+			return "", err
+		}
+		trashDir = filepath.Join(volume, ".Trashes", fmt.Sprint(os.Getuid()))
+	}
+	if err := os.MkdirAll(trashDir, 0700); err != nil {
+		return "", err
+	}
+
+	name, err := uniqueTrashName(trashDir, filepath.Base(path), func(candidate string) bool {
+		_, err := os.Lstat(filepath.Join(trashDir, candidate))
+		return err == nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	trashPath := filepath.Join(trashDir, name)
+	if err := os.Rename(path, trashPath); err != nil {
+		return "", err
+	}
+	return trashPath, nil
+}
+
+// removeTrashInfo macOS 回收站没有单独的信息文件
+func removeTrashInfo(trashPath string) {}
@@ -0,0 +1,137 @@
+//go:build linux
+
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// moveToTrash 按 freedesktop.org Trash 规范放入回收站：优先使用主目录回收站
+// （$XDG_DATA_HOME/Trash），文件与其不在同一设备时使用所在挂载点的 .Trash/$uid 或 .Trash-$uid
+func moveToTrash(path string) (string, error) {
+	homeTrash, err := homeTrashDir()
+	if err != nil {
+		return "", err
+	}
+
+	if sameDevice(path, homeTrash) {
+		return trashInto(homeTrash, path, path)
+	}
+
+	topdir, err := mountPoint(path)
+	if err != nil {
+		return "", err
+	}
+	trashDir, err := topdirTrashDir(topdir)
+	if err != nil {
+		return "", err
+	}
+	// 挂载点回收站中记录相对于挂载点的路径
+	rel, err := filepath.Rel(topdir, path)
+	if err != nil {
+		return "", err
+	}
+	return trashInto(trashDir, path, rel)
+}
+
+// homeTrashDir 返回主目录回收站，必要时创建
+func homeTrashDir() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataHome = filepath.Join(homeDir, ".local", "share")
+	}
+	trashDir := filepath.Join(dataHome, "Trash")
+	if err := ensureTrashDirs(trashDir); err != nil {
+		return "", err
+	}
+	return trashDir, nil
+}
+
+// topdirTrashDir 返回挂载点下可用的回收站：管理员创建的 .Trash（必须设置粘滞位且不是符号链接）
+// 中的 $uid 子目录，否则使用 .Trash-$uid
+func topdirTrashDir(topdir string) (string, error) {
+	uid := fmt.Sprint(os.Getuid())
+
+	shared := filepath.Join(topdir, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		trashDir := filepath.Join(shared, uid)
+		if err := ensureTrashDirs(trashDir); err == nil {
+			return trashDir, nil
+		}
+	}
+
+	trashDir := filepath.Join(topdir, ".Trash-"+uid)
+	if err := ensureTrashDirs(trashDir); err != nil {
+		return "", err
+	}
+	return trashDir, nil
+}
+
+func ensureTrashDirs(trashDir string) error {
+	for _, dir := range []string{filepath.Join(trashDir, "files"), filepath.Join(trashDir, "info")} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trashInto 先以独占方式创建 .trashinfo 占用名称，再把文件移入 files 目录
+func trashInto(trashDir, path, infoPath string) (string, error) {
+	filesDir := filepath.Join(trashDir, "files")
+	infoDir := filepath.Join(trashDir, "info")
+
+	var infoFile *os.File
+	name, err := uniqueTrashName(filesDir, filepath.Base(path), func(candidate string) bool {
+		if _, err := os.Lstat(filepath.Join(filesDir, candidate)); err == nil {
+			return true
+		}
+		file, err := os.OpenFile(filepath.Join(infoDir, candidate+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return true
+		}
+		infoFile = file
+		return false
+	})
+	if err != nil {
+		return "", err
+	}
+	infoName := filepath.Join(infoDir, name+".trashinfo")
+
+	content := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: infoPath}).EscapedPath(),
+		time.Now().Format("2006-01-02T15:04:05"))
+	_, err = infoFile.WriteString(content)
+	if closeErr := infoFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(infoName)
+		return "", err
+	}
+
+	trashPath := filepath.Join(filesDir, name)
+	if err := os.Rename(path, trashPath); err != nil {
+		os.Remove(infoName)
+		return "", err
+	}
+	return trashPath, nil
+}
+
+// removeTrashInfo 还原后删除对应的 .trashinfo
+func removeTrashInfo(trashPath string) {
+	filesDir := filepath.Dir(trashPath)
+	if filepath.Base(filesDir) != "files" {
+		return
+	}
+	infoName := filepath.Join(filepath.Dir(filesDir), "info", filepath.Base(trashPath)+".trashinfo")
+	os.Remove(infoName)
+}
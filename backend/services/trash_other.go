@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package services
+
+import "errors"
+
+// moveToTrash 当前平台暂不支持回收站，调用方会保留源文件
+func moveToTrash(path string) (string, error) {
+	return "", errors.New("当前平台不支持回收站")
+}
+
+func removeTrashInfo(trashPath string) {}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"main/database"
+	"main/models"
+)
+
+// ErrUndoRejected 撤销条件不满足（目标已变化、原路径被占用等）
+var ErrUndoRejected = errors.New("无法撤销")
+
+// ErrHistoryNotFound 历史记录不存在
+var ErrHistoryNotFound = errors.New("历史记录不存在")
+
+// UndoHistory 撤销一条历史记录对应的文件操作，成功后通知订阅了 undone 事件的 webhook
+func UndoHistory(id int64) error {
+	if err := undoHistory(id); err != nil {
+		return err
+	}
+	fireUndoWebhooks(id)
+	return nil
+}
+
+func undoHistory(id int64) error {
+	record, err := database.GetHistoryRecord(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrHistoryNotFound
+		}
+		return err
+	}
+
+	if record.UndoneAt != "" {
+		return fmt.Errorf("%w: 该记录已撤销", ErrUndoRejected)
+	}
+	if record.Action == HistoryActionSweep {
+		return fmt.Errorf("%w: 定时整理汇总记录不能撤销，请撤销其中的单个文件", ErrUndoRejected)
+	}
+	if record.Action == ActionPipeline {
+		return undoPipeline(record)
+	}
+	// 重复文件被放入回收站时，撤销只需从回收站还原
+	if record.Status == "skipped" && record.TrashPath != "" {
+		if err := RestoreFromTrash(record.TrashPath, record.OriginalPath); err != nil {
+			return fmt.Errorf("%w: %v", ErrUndoRejected, err)
+		}
+		return database.MarkHistoryUndone(id)
+	}
+	if record.Status != "success" {
+		return fmt.Errorf("%w: 只能撤销处理成功的记录", ErrUndoRejected)
+	}
+
+	if err := verifyUnchanged(record); err != nil {
+		return err
+	}
+
+	if record.TrashPath != "" {
+		// 原文件在回收站中：先还原原文件，再删除目标
+		if err := RestoreFromTrash(record.TrashPath, record.OriginalPath); err != nil {
+			return fmt.Errorf("%w: %v", ErrUndoRejected, err)
+		}
+		if err := os.RemoveAll(record.NewPath); err != nil {
+			return fmt.Errorf("删除目标文件失败: %v", err)
+		}
+	} else if record.OriginalRemoved {
+		if _, err := os.Lstat(record.OriginalPath); err == nil {
+			return fmt.Errorf("%w: 原路径已存在文件 %s", ErrUndoRejected, record.OriginalPath)
+		}
+		if err := os.MkdirAll(filepath.Dir(record.OriginalPath), 0755); err != nil {
+			return err
+		}
+		if err := MovePath(record.NewPath, record.OriginalPath, nil); err != nil {
+			return fmt.Errorf("还原文件失败: %v", err)
+		}
+	} else {
+		if err := os.RemoveAll(record.NewPath); err != nil {
+			return fmt.Errorf("删除目标文件失败: %v", err)
+		}
+	}
+
+	if err := database.MarkHistoryUndone(id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// verifyUnchanged 确认目标文件在写入后未被修改
+func verifyUnchanged(record models.HistoryRecord) error {
+	info, err := os.Lstat(record.NewPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: 目标文件不存在 %s", ErrUndoRejected, record.NewPath)
+		}
+		return err
+	}
+
+	if record.ContentHash == "" {
+		return fmt.Errorf("%w: 该记录缺少校验信息", ErrUndoRejected)
+	}
+	size, err := PathSize(record.NewPath)
+	if err != nil {
+		return err
+	}
+	if size != record.Size {
+		return fmt.Errorf("%w: 目标文件已被修改", ErrUndoRejected)
+	}
+	if info.ModTime().UnixNano() == record.ModTime {
+		return nil
+	}
+
+	// 修改时间变化时以内容哈希为准
+	hash, err := HashPath(record.NewPath)
+	if err != nil {
+		return err
+	}
+	if hash != record.ContentHash {
+		return fmt.Errorf("%w: 目标文件已被修改", ErrUndoRejected)
+	}
+	return nil
+}
+
+// FileState 获取文件或目录写入后的状态（哈希、大小、修改时间）
+func FileState(path string) (hash string, size int64, modTime int64, err error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	size, err = PathSize(path)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	hash, err = HashPath(path)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return hash, size, info.ModTime().UnixNano(), nil
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"main/database"
+	"main/models"
+)
+
+// initTestDB 在临时主目录下初始化数据库
+func initTestDB(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := database.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+	return home
+}
+
+// movedTestRecord 将 src 移动到 dst 并返回对应的历史记录
+func movedTestRecord(t *testing.T, src, dst string) models.HistoryRecord {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := MovePath(src, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	hash, size, modTime, err := FileState(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.HistoryRecord{
+		OriginalPath:    src,
+		OriginalName:    filepath.Base(src),
+		NewPath:         dst,
+		NewName:         filepath.Base(dst),
+		Action:          ActionMove,
+		Status:          "success",
+		ContentHash:     hash,
+		Size:            size,
+		ModTime:         modTime,
+		OriginalRemoved: true,
+	}
+}
+
+func TestVerifyUnchanged(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+	cases := []struct {
+		name   string
+		change func(t *testing.T, record *models.HistoryRecord)
+		reject bool
+	}{
+		{name: "unchanged", change: func(t *testing.T, record *models.HistoryRecord) {}},
+		{
+			name: "touched with the same content",
+			change: func(t *testing.T, record *models.HistoryRecord) {
+				setTestModTime(t, record.NewPath, later)
+			},
+		},
+		{
+			name: "same size, different content",
+			change: func(t *testing.T, record *models.HistoryRecord) {
+				writeTestFile(t, record.NewPath, "XXXXXXX")
+				setTestModTime(t, record.NewPath, later)
+			},
+			reject: true,
+		},
+		{
+			name: "different size",
+			change: func(t *testing.T, record *models.HistoryRecord) {
+				writeTestFile(t, record.NewPath, "longer content")
+			},
+			reject: true,
+		},
+		{
+			name: "target removed",
+			change: func(t *testing.T, record *models.HistoryRecord) {
+				os.Remove(record.NewPath)
+			},
+			reject: true,
+		},
+		{
+			name: "record without a hash",
+			change: func(t *testing.T, record *models.HistoryRecord) {
+				record.ContentHash = ""
+			},
+			reject: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			base := t.TempDir()
+			src := filepath.Join(base, "in", "a.txt")
+			writeTestFile(t, src, "content")
+			record := movedTestRecord(t, src, filepath.Join(base, "out", "a.txt"))
+			tc.change(t, &record)
+
+			err := verifyUnchanged(record)
+			if tc.reject && !errors.Is(err, ErrUndoRejected) {
+				t.Fatalf("verifyUnchanged error = %v, want ErrUndoRejected", err)
+			}
+			if !tc.reject && err != nil {
+				t.Fatalf("verifyUnchanged error = %v", err)
+			}
+		})
+	}
+}
+
+func TestUndoHistory(t *testing.T) {
+	cases := []struct {
+		name    string
+		change  func(t *testing.T, record models.HistoryRecord)
+		restore bool
+	}{
+		{name: "restores a moved file", change: func(t *testing.T, record models.HistoryRecord) {}, restore: true},
+		{
+			name: "rejects a modified target",
+			change: func(t *testing.T, record models.HistoryRecord) {
+				writeTestFile(t, record.NewPath, "changed")
+			},
+		},
+		{
+			name: "rejects an occupied original path",
+			change: func(t *testing.T, record models.HistoryRecord) {
+				writeTestFile(t, record.OriginalPath, "new file")
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			home := initTestDB(t)
+			src := filepath.Join(home, "in", "a.txt")
+			dst := filepath.Join(home, "out", "a.txt")
+			writeTestFile(t, src, "content")
+			record := movedTestRecord(t, src, dst)
+			id, err := database.SaveHistory(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.change(t, record)
+
+			err = UndoHistory(id)
+			if !tc.restore {
+				if !errors.Is(err, ErrUndoRejected) {
+					t.Fatalf("UndoHistory error = %v, want ErrUndoRejected", err)
+				}
+				if _, err := os.Stat(dst); err != nil {
+					t.Fatalf("target removed by a rejected undo: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err := os.ReadFile(src); err != nil || string(data) != "content" {
+				t.Fatalf("original = %q, %v", data, err)
+			}
+			if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+				t.Fatalf("target still exists after undo")
+			}
+			if err := UndoHistory(id); !errors.Is(err, ErrUndoRejected) {
+				t.Fatalf("second UndoHistory error = %v, want ErrUndoRejected", err)
+			}
+		})
+	}
+}
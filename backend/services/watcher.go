@@ -0,0 +1,467 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"main/database"
+	"main/models"
+)
+
+// 监听文件夹运行方式
+const (
+	WatchModeInotify = "inotify"
+	WatchModePolling = "polling"
+)
+
+const (
+	// watchDebounce 最后一次文件事件之后至少等待的时间
+	watchDebounce = 2 * time.Second
+	// watchCheckInterval 检查待处理文件是否写入完成的间隔
+	watchCheckInterval = time.Second
+	// watchPollInterval 轮询模式下扫描目录的间隔
+	watchPollInterval = 3 * time.Second
+	// watchOutputTTL 处理产生的目标文件在该时间内不会被再次处理，避免目标目录位于监听目录内时循环处理
+	watchOutputTTL = 10 * time.Minute
+)
+
+// 下载器、编辑器等写入过程中使用的临时文件后缀
+var watchIgnoredSuffixes = []string{
+	".tmp", ".temp", ".part", ".partial", ".crdownload", ".download", ".swp", "~",
+}
+
+// fsNotifier 文件系统事件源，推送发生变化的文件路径
+type fsNotifier interface {
+	Events() <-chan string
+	Close() error
+}
+
+// watchManager 管理所有运行中的监听文件夹
+type watchManager struct {
+	mu       sync.Mutex
+	watchers map[string]*folderWatcher
+	outputs  map[string]time.Time
+}
+
+var watchers = &watchManager{
+	watchers: make(map[string]*folderWatcher),
+	outputs:  make(map[string]time.Time),
+}
+
+// StartWatchers 启动所有已启用的监听文件夹
+func StartWatchers() error {
+	folders, err := database.GetWatchFolders()
+	if err != nil {
+		return err
+	}
+
+	started := 0
+	for _, folder := range folders {
+		if !folder.Enabled {
+			continue
+		}
+		if err := watchers.start(folder); err != nil {
+			log.Printf("启动监听文件夹失败 %s: %v", folder.Path, err)
+			continue
+		}
+		started++
+	}
+
+	log.Printf("👀 Watch folders started: %d", started)
+	return nil
+}
+
+// ReloadWatcher 按数据库中的最新配置重启监听文件夹，已删除或已禁用的只停止
+func ReloadWatcher(id string) error {
+	watchers.stop(id)
+
+	folder, err := database.GetWatchFolder(id)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !folder.Enabled {
+		return nil
+	}
+	return watchers.start(folder)
+}
+
+// ListWatchFolders 获取监听文件夹列表，并附带运行状态
+func ListWatchFolders() ([]models.WatchFolder, error) {
+	folders, err := database.GetWatchFolders()
+	if err != nil {
+		return nil, err
+	}
+	for i := range folders {
+		folders[i].Mode = watchers.mode(folders[i].ID)
+	}
+	return folders, nil
+}
+
+// NormalizeWatchFolder 校验监听文件夹配置，并将路径整理为绝对路径
+func NormalizeWatchFolder(folder *models.WatchFolder) error {
+	if strings.TrimSpace(folder.Path) == "" {
+		return errors.New("监听路径不能为空")
+	}
+
+	path, err := filepath.Abs(expandHome(strings.TrimSpace(folder.Path)))
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("监听路径不可用: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("监听路径不是文件夹: %s", path)
+	}
+	folder.Path = path
+
+	if folder.RuleID != "" {
+		if _, err := database.GetRule(folder.RuleID); err != nil {
+			return fmt.Errorf("规则不存在: %s", folder.RuleID)
+		}
+	}
+	return nil
+}
+
+func (m *watchManager) start(folder models.WatchFolder) error {
+	watcher := &folderWatcher{
+		folder:   folder,
+		done:     make(chan struct{}),
+		pending:  make(map[string]*pendingFile),
+		inFlight: make(map[string]bool),
+	}
+
+	notifier, err := newFSNotifier(folder.Path, folder.Recursive)
+	if err != nil {
+		log.Printf("监听文件夹 %s 使用轮询模式: %v", folder.Path, err)
+		watcher.mode = WatchModePolling
+	} else {
+		watcher.mode = WatchModeInotify
+	}
+
+	m.mu.Lock()
+	if existing, ok := m.watchers[folder.ID]; ok {
+		existing.stop()
+	}
+	m.watchers[folder.ID] = watcher
+	m.mu.Unlock()
+
+	go watcher.run(notifier)
+	log.Printf("开始监听文件夹: %s (%s)", folder.Path, watcher.mode)
+	return nil
+}
+
+func (m *watchManager) stop(id string) {
+	m.mu.Lock()
+	watcher, ok := m.watchers[id]
+	delete(m.watchers, id)
+	m.mu.Unlock()
+
+	if ok {
+		watcher.stop()
+		log.Printf("停止监听文件夹: %s", watcher.folder.Path)
+	}
+}
+
+func (m *watchManager) mode(id string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if watcher, ok := m.watchers[id]; ok {
+		return watcher.currentMode()
+	}
+	return ""
+}
+
+// rememberOutputs 记录处理产生的目标路径
+func (m *watchManager) rememberOutputs(response models.FileProcessResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var walk func(models.FileProcessResponse)
+	walk = func(r models.FileProcessResponse) {
+		if r.Destination != "" {
+			m.outputs[r.Destination] = time.Now()
+		}
+		for _, step := range r.Steps {
+			if step.Output != "" {
+				m.outputs[step.Output] = time.Now()
+			}
+		}
+		for _, child := range r.Children {
+			walk(child)
+		}
+	}
+	walk(response)
+}
+
+// isRecentOutput 判断路径是否为最近处理产生的目标文件
+func (m *watchManager) isRecentOutput(path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for output, at := range m.outputs {
+		if now.Sub(at) > watchOutputTTL {
+			delete(m.outputs, output)
+		}
+	}
+	for output := range m.outputs {
+		if path == output || strings.HasPrefix(path, output+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingFile 等待写入完成的文件
+type pendingFile struct {
+	lastEvent time.Time
+	size      int64
+	modTime   time.Time
+	observed  bool
+}
+
+// fileStamp 轮询模式下记录的文件状态
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// folderWatcher 单个监听文件夹：收集文件事件，去抖并等待文件不再增长后交给处理流程
+type folderWatcher struct {
+	folder   models.WatchFolder
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// pending 与 snapshot 只在 run 所在的 goroutine 中访问
+	pending  map[string]*pendingFile
+	snapshot map[string]fileStamp
+
+	mu        sync.Mutex
+	mode      string
+	inFlight  map[string]bool
+	processMu sync.Mutex
+}
+
+func (w *folderWatcher) stop() {
+	w.stopOnce.Do(func() { close(w.done) })
+}
+
+func (w *folderWatcher) currentMode() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.mode
+}
+
+func (w *folderWatcher) run(notifier fsNotifier) {
+	checkTicker := time.NewTicker(watchCheckInterval)
+	defer checkTicker.Stop()
+
+	var events <-chan string
+	var poll <-chan time.Time
+	startPolling := func() {
+		w.snapshot = w.scan()
+		pollTicker := time.NewTicker(watchPollInterval)
+		poll = pollTicker.C
+		go func() {
+			<-w.done
+			pollTicker.Stop()
+		}()
+	}
+
+	if notifier != nil {
+		defer notifier.Close()
+		events = notifier.Events()
+	} else {
+		startPolling()
+	}
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case path, ok := <-events:
+			if !ok {
+				// 事件源异常退出，改用轮询
+				log.Printf("监听文件夹 %s 的事件源已关闭，改用轮询模式", w.folder.Path)
+				events = nil
+				w.mu.Lock()
+				w.mode = WatchModePolling
+				w.mu.Unlock()
+				startPolling()
+				continue
+			}
+			w.touch(path)
+		case <-poll:
+			w.pollChanges()
+		case <-checkTicker.C:
+			w.checkPending()
+		}
+	}
+}
+
+// touch 记录文件事件，重新开始去抖计时
+func (w *folderWatcher) touch(path string) {
+	if !w.accepts(path) {
+		return
+	}
+	if p, ok := w.pending[path]; ok {
+		p.lastEvent = time.Now()
+		return
+	}
+	w.pending[path] = &pendingFile{lastEvent: time.Now()}
+}
+
+// accepts 判断路径是否需要处理：忽略隐藏文件、临时文件以及非递归模式下的子目录内容
+func (w *folderWatcher) accepts(path string) bool {
+	rel, err := filepath.Rel(w.folder.Path, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if !w.folder.Recursive && len(parts) > 1 {
+		return false
+	}
+	for _, part := range parts {
+		if strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return !isIgnoredWatchFile(parts[len(parts)-1])
+}
+
+func isIgnoredWatchFile(name string) bool {
+	lower := strings.ToLower(name)
+	if strings.HasPrefix(lower, "~$") {
+		return true
+	}
+	for _, suffix := range watchIgnoredSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPending 文件在去抖时间内没有新事件，且两次检查之间大小和修改时间都未变化，才认为写入完成
+func (w *folderWatcher) checkPending() {
+	now := time.Now()
+	for path, p := range w.pending {
+		if now.Sub(p.lastEvent) < watchDebounce {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			delete(w.pending, path)
+			continue
+		}
+
+		if !p.observed || info.Size() != p.size || !info.ModTime().Equal(p.modTime) {
+			p.observed = true
+			p.size = info.Size()
+			p.modTime = info.ModTime()
+			continue
+		}
+
+		delete(w.pending, path)
+		if watchers.isRecentOutput(path) {
+			continue
+		}
+
+		w.mu.Lock()
+		busy := w.inFlight[path]
+		w.inFlight[path] = true
+		w.mu.Unlock()
+		if !busy {
+			go w.process(path)
+		}
+	}
+}
+
+// process 按监听文件夹的配置处理文件，同一文件夹内的文件依次处理
+func (w *folderWatcher) process(path string) {
+	defer func() {
+		w.mu.Lock()
+		delete(w.inFlight, path)
+		w.mu.Unlock()
+	}()
+
+	w.processMu.Lock()
+	defer w.processMu.Unlock()
+
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	if _, err := os.Stat(path); err != nil || watchers.isRecentOutput(path) {
+		return
+	}
+
+	log.Printf("监听文件夹 %s 发现新文件: %s", w.folder.Path, path)
+	ctx := WithEventScope(context.Background(), "", "", path)
+	response, err := ProcessFile(ctx, models.FileProcessRequest{
+		FilePath: path,
+		UseAI:    w.folder.UseAI,
+		Model:    w.folder.Model,
+		RuleID:   w.folder.RuleID,
+	})
+	if err != nil {
+		log.Printf("自动处理失败 %s: %v", path, err)
+		return
+	}
+	watchers.rememberOutputs(*response)
+}
+
+// scan 扫描监听目录下的文件状态
+func (w *folderWatcher) scan() map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	filepath.WalkDir(w.folder.Path, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != w.folder.Path && (!w.folder.Recursive || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !w.accepts(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		stamps[path] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return stamps
+}
+
+// pollChanges 轮询模式：与上次扫描结果比较，新增或变化的文件视为文件事件。
+// 启动时已存在的文件不会被处理
+func (w *folderWatcher) pollChanges() {
+	current := w.scan()
+	for path, stamp := range current {
+		previous, ok := w.snapshot[path]
+		if !ok || previous != stamp {
+			w.touch(path)
+		}
+	}
+	w.snapshot = current
+}
@@ -0,0 +1,182 @@
+//go:build linux
+
+package services
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask 只关心写入完成和移入的文件；IN_CREATE 用于发现新建的子目录
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_CREATE
+
+// inotifyNotifier 基于 inotify 的文件事件源
+type inotifyNotifier struct {
+	fd        int
+	recursive bool
+	watches   map[int]string
+	events    chan string
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newFSNotifier(root string, recursive bool) (fsNotifier, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &inotifyNotifier{
+		fd:        fd,
+		recursive: recursive,
+		watches:   make(map[int]string),
+		events:    make(chan string, 64),
+		done:      make(chan struct{}),
+	}
+	if err := n.addWatch(root); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	if recursive {
+		n.addTree(root, false)
+	}
+
+	go n.readLoop()
+	return n, nil
+}
+
+func (n *inotifyNotifier) Events() <-chan string {
+	return n.events
+}
+
+func (n *inotifyNotifier) Close() error {
+	n.closeOnce.Do(func() { close(n.done) })
+	return nil
+}
+
+func (n *inotifyNotifier) addWatch(dir string) error {
+	wd, err := unix.InotifyAddWatch(n.fd, dir, inotifyMask)
+	if err != nil {
+		return err
+	}
+	n.watches[wd] = dir
+	return nil
+}
+
+// addTree 为目录下的所有子目录添加监听；emit 为 true 时同时推送目录中已有的文件（整个目录被移入时）
+func (n *inotifyNotifier) addTree(root string, emit bool) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if err := n.addWatch(path); err != nil {
+				log.Printf("添加目录监听失败 %s: %v", path, err)
+			}
+			return nil
+		}
+		if emit && d.Type().IsRegular() {
+			n.emit(path)
+		}
+		return nil
+	})
+}
+
+func (n *inotifyNotifier) emit(path string) bool {
+	select {
+	case n.events <- path:
+		return true
+	case <-n.done:
+		return false
+	}
+}
+
+func (n *inotifyNotifier) readLoop() {
+	defer close(n.events)
+	defer unix.Close(n.fd)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		fds := []unix.PollFd{{Fd: int32(n.fd), Events: unix.POLLIN}}
+		// 定时醒来检查是否已关闭
+		_, err := unix.Poll(fds, 500)
+
+		select {
+		case <-n.done:
+			return
+		default:
+		}
+
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			log.Printf("inotify poll 失败: %v", err)
+			return
+		}
+		if fds[0].Revents&unix.POLLIN == 0 {
+			continue
+		}
+
+		count, err := unix.Read(n.fd, buf)
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			log.Printf("读取 inotify 事件失败: %v", err)
+			return
+		}
+		if !n.handle(buf[:count]) {
+			return
+		}
+	}
+}
+
+// handle 解析一批 inotify 事件，返回 false 表示已关闭
+func (n *inotifyNotifier) handle(buf []byte) bool {
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + unix.SizeofInotifyEvent
+		nameEnd := nameStart + int(event.Len)
+		if nameEnd > len(buf) {
+			break
+		}
+		name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+		offset = nameEnd
+
+		if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+			log.Printf("inotify 事件队列溢出，部分文件可能未被处理")
+			continue
+		}
+		if event.Mask&unix.IN_IGNORED != 0 {
+			delete(n.watches, int(event.Wd))
+			continue
+		}
+
+		dir, ok := n.watches[int(event.Wd)]
+		if !ok || name == "" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+
+		if event.Mask&unix.IN_ISDIR != 0 {
+			if n.recursive && !strings.HasPrefix(name, ".") {
+				n.addTree(path, true)
+			}
+			continue
+		}
+		if !n.emit(path) {
+			return false
+		}
+	}
+	return true
+}
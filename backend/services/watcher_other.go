@@ -0,0 +1,10 @@
+//go:build !linux
+
+package services
+
+import "errors"
+
+// newFSNotifier 非 Linux 平台暂无原生实现，由调用方回退为轮询
+func newFSNotifier(root string, recursive bool) (fsNotifier, error) {
+	return nil, errors.New("当前平台不支持 inotify")
+}
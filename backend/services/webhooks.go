@@ -0,0 +1,384 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"main/database"
+	"main/models"
+)
+
+// webhook 事件
+const (
+	WebhookEventSuccess = "success" // 处理完成（包括因冲突跳过）
+	WebhookEventFailed  = "failed"  // 处理失败（包括流水线部分步骤失败）
+	WebhookEventUndone  = "undone"  // 历史记录被撤销
+	WebhookEventTest    = "test"    // 手动测试
+)
+
+// 投递状态
+const (
+	DeliveryPending = "pending"
+	DeliverySuccess = "success"
+	DeliveryFailed  = "failed"
+)
+
+// 请求头，签名为 HMAC-SHA256(secret, 时间戳 + "." + 请求体) 的十六进制
+const (
+	WebhookEventHeader     = "X-BlackHole-Event"
+	WebhookDeliveryHeader  = "X-BlackHole-Delivery"
+	WebhookTimestampHeader = "X-BlackHole-Timestamp"
+	WebhookSignatureHeader = "X-BlackHole-Signature"
+)
+
+const (
+	webhookTimeout      = 10 * time.Second
+	webhookTick         = 5 * time.Second
+	webhookBatchSize    = 20
+	webhookResponseSize = 64 << 10
+)
+
+// webhookBackoff 第 n 次投递失败后等待的时间，全部用完后不再重试
+var webhookBackoff = []time.Duration{
+	30 * time.Second,
+	2 * time.Minute,
+	10 * time.Minute,
+	time.Hour,
+}
+
+// ErrWebhookNotFound webhook 不存在
+var ErrWebhookNotFound = errors.New("webhook 不存在")
+
+// webhookDispatcher 按重试时间从数据库取出待投递记录并发送
+type webhookDispatcher struct {
+	mu       sync.Mutex
+	inFlight map[int64]bool
+	wake     chan struct{}
+}
+
+var webhooks = &webhookDispatcher{
+	inFlight: make(map[int64]bool),
+	wake:     make(chan struct{}, 1),
+}
+
+// StartWebhookDispatcher 启动投递循环，上次退出前未完成的投递会继续重试
+func StartWebhookDispatcher() {
+	go webhooks.run()
+}
+
+func (d *webhookDispatcher) run() {
+	ticker := time.NewTicker(webhookTick)
+	defer ticker.Stop()
+
+	d.dispatchDue()
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.wake:
+		}
+		d.dispatchDue()
+	}
+}
+
+func (d *webhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *webhookDispatcher) dispatchDue() {
+	deliveries, err := database.GetDueWebhookDeliveries(time.Now(), webhookBatchSize)
+	if err != nil {
+		log.Printf("读取待投递 webhook 失败: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		d.mu.Lock()
+		if d.inFlight[delivery.ID] {
+			d.mu.Unlock()
+			continue
+		}
+		d.inFlight[delivery.ID] = true
+		d.mu.Unlock()
+
+		go func(delivery models.WebhookDelivery) {
+			defer func() {
+				d.mu.Lock()
+				delete(d.inFlight, delivery.ID)
+				d.mu.Unlock()
+			}()
+			deliverWebhook(delivery, true)
+		}(delivery)
+	}
+}
+
+// NormalizeWebhook 校验并补全 webhook 配置，密钥为空时生成随机密钥
+func NormalizeWebhook(webhook *models.Webhook) error {
+	webhook.URL = strings.TrimSpace(webhook.URL)
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url 必须是 http 或 https 地址")
+	}
+
+	webhook.Name = strings.TrimSpace(webhook.Name)
+	if webhook.Name == "" {
+		webhook.Name = parsed.Host
+	}
+
+	events := make([]string, 0, len(webhook.Events))
+	for _, event := range webhook.Events {
+		switch event {
+		case WebhookEventSuccess, WebhookEventFailed, WebhookEventUndone:
+		default:
+			return fmt.Errorf("不支持的事件: %s", event)
+		}
+		if !containsString(events, event) {
+			events = append(events, event)
+		}
+	}
+	webhook.Events = events
+
+	if webhook.RuleID != "" {
+		if _, err := database.GetRule(webhook.RuleID); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrRuleNotFound
+			}
+			return err
+		}
+	}
+
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+	return nil
+}
+
+// subscribes 判断 webhook 是否订阅了该规则的事件
+func subscribes(webhook models.Webhook, event, ruleID string) bool {
+	if !webhook.Enabled {
+		return false
+	}
+	if webhook.RuleID != "" && webhook.RuleID != ruleID {
+		return false
+	}
+	return len(webhook.Events) == 0 || containsString(webhook.Events, event)
+}
+
+// fireCompletedWebhooks 处理完成后发送 webhook，流水线部分步骤失败时按失败事件发送
+func fireCompletedWebhooks(ruleID string, response *models.FileProcessResponse) {
+	if response.Status == "partial" {
+		FireWebhooks(WebhookEventFailed, ruleID, response.HistoryID, response, response.Error)
+		return
+	}
+	FireWebhooks(WebhookEventSuccess, ruleID, response.HistoryID, response, "")
+}
+
+// FireWebhooks 为订阅了该事件的 webhook 创建投递记录，由投递循环异步发送
+func FireWebhooks(event, ruleID string, historyID int64, response *models.FileProcessResponse, errMessage string) {
+	list, err := database.GetWebhooks()
+	if err != nil {
+		log.Printf("读取 webhook 失败: %v", err)
+		return
+	}
+
+	payload, err := json.Marshal(models.WebhookPayload{
+		Event:     event,
+		Timestamp: time.Now().Format(time.RFC3339),
+		RuleID:    ruleID,
+		HistoryID: historyID,
+		Error:     errMessage,
+		Response:  response,
+	})
+	if err != nil {
+		log.Printf("生成 webhook 内容失败: %v", err)
+		return
+	}
+
+	queued := false
+	for _, webhook := range list {
+		if !subscribes(webhook, event, ruleID) {
+			continue
+		}
+		_, err := database.CreateWebhookDelivery(models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        DeliveryPending,
+			NextAttemptAt: formatDeliveryTime(time.Now()),
+		})
+		if err != nil {
+			log.Printf("创建 webhook 投递记录失败: %v", err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		webhooks.notify()
+	}
+}
+
+// fireUndoWebhooks 撤销成功后通知订阅者
+func fireUndoWebhooks(id int64) {
+	record, err := database.GetHistoryRecord(id)
+	if err != nil {
+		log.Printf("读取历史记录失败: %v", err)
+		return
+	}
+	FireWebhooks(WebhookEventUndone, record.RuleID, record.ID, &models.FileProcessResponse{
+		OriginalPath: record.OriginalPath,
+		OriginalName: record.OriginalName,
+		NewName:      record.NewName,
+		Destination:  record.NewPath,
+		RuleUsed:     record.RuleName,
+		Status:       record.Status,
+		Conflict:     record.Conflict,
+		HistoryID:    record.ID,
+		Steps:        record.Steps,
+	}, "")
+}
+
+// TestWebhook 立即发送一次测试事件（不重试），返回投递结果
+func TestWebhook(id string) (models.WebhookDelivery, error) {
+	webhook, err := database.GetWebhook(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.WebhookDelivery{}, ErrWebhookNotFound
+		}
+		return models.WebhookDelivery{}, err
+	}
+
+	payload, err := json.Marshal(models.WebhookPayload{
+		Event:     WebhookEventTest,
+		Timestamp: time.Now().Format(time.RFC3339),
+		RuleID:    webhook.RuleID,
+		Response: &models.FileProcessResponse{
+			OriginalPath: "/path/to/example.pdf",
+			OriginalName: "example.pdf",
+			NewName:      "2024-01-01_example.pdf",
+			Destination:  "/path/to/BlackHole/2024-01-01_example.pdf",
+			RuleUsed:     "默认规则",
+			Status:       "success",
+			Conflict:     ResolutionNone,
+		},
+	})
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	delivery, err := database.CreateWebhookDelivery(models.WebhookDelivery{
+		WebhookID: webhook.ID,
+		Event:     WebhookEventTest,
+		Payload:   string(payload),
+		Status:    DeliveryPending,
+	})
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	return deliverWebhook(delivery, false), nil
+}
+
+// deliverWebhook 发送一次并保存结果；失败且允许重试时按退避时间安排下一次投递
+func deliverWebhook(delivery models.WebhookDelivery, retry bool) models.WebhookDelivery {
+	webhook, err := database.GetWebhook(delivery.WebhookID)
+	if err != nil || !webhook.Enabled {
+		delivery.Status = DeliveryFailed
+		delivery.Error = "webhook 已删除或停用"
+		delivery.NextAttemptAt = ""
+		database.UpdateWebhookDelivery(delivery)
+		return delivery
+	}
+
+	code, err := sendWebhook(webhook, delivery)
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	switch {
+	case err == nil:
+		delivery.Status = DeliverySuccess
+		delivery.Error = ""
+		delivery.NextAttemptAt = ""
+	case retry && delivery.Attempts <= len(webhookBackoff):
+		delivery.Status = DeliveryPending
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = formatDeliveryTime(time.Now().Add(webhookBackoff[delivery.Attempts-1]))
+	default:
+		delivery.Status = DeliveryFailed
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = ""
+	}
+	if err != nil {
+		log.Printf("webhook 投递失败 (%s, 第 %d 次): %v", webhook.URL, delivery.Attempts, err)
+	}
+
+	if err := database.UpdateWebhookDelivery(delivery); err != nil {
+		log.Printf("保存 webhook 投递结果失败: %v", err)
+	}
+	return delivery
+}
+
+// sendWebhook POST 签名后的内容，非 2xx 响应视为失败
+func sendWebhook(webhook models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BlackHole-Webhook")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookResponseSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("返回状态码 %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload 计算签名：HMAC-SHA256(secret, timestamp + "." + payload)
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// formatDeliveryTime 重试时间统一使用 UTC，保证数据库中按字符串比较的顺序正确
+func formatDeliveryTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}